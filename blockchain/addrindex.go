@@ -0,0 +1,204 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type (
+	//AddressTx is one entry of the history of an address
+	AddressTx struct {
+		TxID      []byte
+		BlockHash []byte
+		Height    int
+		Timestamp int64
+		//Amount is what the address received minus what it spent in the transaction
+		Amount int
+		//Coinbase is set for the coinbase of the block, which mints the reward
+		Coinbase bool
+	}
+)
+
+const (
+	//proofPageSize is how many history entries GetAddressProofs reads at once
+	proofPageSize = 100
+)
+
+var (
+	//addr-<pubKeyHash><height><txid> holds the AddressTx of a main chain transaction
+	addrIndexPrefix = []byte("addr-")
+)
+
+func addrIndexKey(pubKeyHash []byte, height int, txID []byte) []byte {
+	key := append(append([]byte{}, addrIndexPrefix...), pubKeyHash...)
+	key = append(key, ToHex(int64(height))...)
+	return append(key, txID...)
+}
+
+func (a AddressTx) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(a)
+	return buffer.Bytes(), err
+}
+
+func DeserializeAddressTx(data []byte) (AddressTx, error) {
+	var entry AddressTx
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&entry)
+	return entry, err
+}
+
+//addressAmounts returns, for every transaction of block, the net amount per
+//public key hash it touches. spent are the outputs the block spent, in order
+func addressAmounts(block *Block, spent []SpentOutput) []map[string]int {
+	var amounts []map[string]int
+
+	next := 0
+	for _, tx := range block.Transaction {
+		txAmounts := make(map[string]int)
+
+		if tx.IsCoinbase() == false {
+			for range tx.Inputs {
+				out := spent[next].Output
+				txAmounts[string(out.PubKeyHash)] -= out.Value
+				next++
+			}
+		}
+		for _, out := range tx.Outputs {
+			if out.IsData() {
+				continue
+			}
+			txAmounts[string(out.PubKeyHash)] += out.Value
+		}
+
+		amounts = append(amounts, txAmounts)
+	}
+
+	return amounts
+}
+
+//indexAddresses records the transactions of a connected block in the history
+//of every address they credit or debit
+func indexAddresses(txn StoreTxn, block *Block, spent []SpentOutput) error {
+	for i, txAmounts := range addressAmounts(block, spent) {
+		tx := block.Transaction[i]
+
+		for pubKeyHash, amount := range txAmounts {
+			entry, err := AddressTx{tx.ID, block.Hash, block.Height, block.Timestamp, amount, tx.IsCoinbase()}.Serialize()
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(addrIndexKey([]byte(pubKeyHash), block.Height, tx.ID), entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func unindexAddresses(txn StoreTxn, block *Block, spent []SpentOutput) error {
+	for i, txAmounts := range addressAmounts(block, spent) {
+		tx := block.Transaction[i]
+
+		for pubKeyHash := range txAmounts {
+			if err := txn.Delete(addrIndexKey([]byte(pubKeyHash), block.Height, tx.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//GetAddressHistory returns up to limit transactions of pubKeyHash, newest
+//first, starting below cursor or from the newest one when it is nil. It also
+//returns the cursor of the next page, nil after the oldest transaction
+func (chain *Blockchain) GetAddressHistory(pubKeyHash, cursor []byte, limit int) ([]AddressTx, []byte, error) {
+	var (
+		history []AddressTx
+		next    []byte
+		before  []byte
+	)
+
+	prefix := append(append([]byte{}, addrIndexPrefix...), pubKeyHash...)
+	if cursor != nil {
+		before = append(append([]byte{}, prefix...), cursor...)
+	}
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		var (
+			last []byte
+			err  error
+		)
+
+		iterErr := txn.IterateReverse(prefix, before, func(key, value []byte) bool {
+			if len(history) == limit {
+				next = last[len(prefix):]
+				return false
+			}
+			var entry AddressTx
+			if entry, err = DeserializeAddressTx(value); err != nil {
+				return false
+			}
+			history = append(history, entry)
+			last = key
+			return true
+		})
+		if iterErr != nil {
+			return iterErr
+		}
+
+		return err
+	})
+
+	return history, next, err
+}
+
+//GetAddressProofs returns every main chain transaction of pubKeyHash with the
+//merkle proof that it is in its block, for light nodes
+func (chain *Blockchain) GetAddressProofs(pubKeyHash []byte) ([]Transaction, []TxProof, error) {
+	var (
+		txs    []Transaction
+		proofs []TxProof
+		cursor []byte
+	)
+	blocks := make(map[string]Block)
+
+	for {
+		history, next, err := chain.GetAddressHistory(pubKeyHash, cursor, proofPageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, entry := range history {
+			block, ok := blocks[string(entry.BlockHash)]
+			if !ok {
+				block, err = chain.GetBlock(entry.BlockHash)
+				if err == ErrBlockNotFound && entry.Height < chain.Base {
+					//pruned, it cannot be proven anymore
+					continue
+				} else if err != nil {
+					return nil, nil, err
+				}
+				blocks[string(entry.BlockHash)] = block
+			}
+			proof, err := block.MerkleProof(entry.TxID)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			tx := block.Transaction[proof.Index]
+			txs = append(txs, *tx)
+			proofs = append(proofs, TxProof{tx.ID, block.Hash, block.BlockHeader, proof})
+		}
+
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	return txs, proofs, nil
+}
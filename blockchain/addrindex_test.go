@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestAddressHistoryPages(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+	UTXO := &UTXOSet{chain}
+
+	//two payments to b in every block
+	var want [][]byte
+	parent := tipBlock(t, chain)
+	for i := 0; i < 3; i++ {
+		first, err := NewTransaction(a, string(a.Address()), string(b.Address()), 2, 0, UTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second := spendOutput(t, a, first, 1, b, 1, 0)
+		parent = addTestBlock(t, chain, parent, forger, 0, first, second)
+		want = append([][]byte{second.ID, first.ID}, want...)
+	}
+
+	pubKeyHash := wallet.PublicKeyHash(b.Publickey)
+	var (
+		got    [][]byte
+		cursor []byte
+		pages  int
+	)
+	for {
+		history, next, err := chain.GetAddressHistory(pubKeyHash, cursor, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range history {
+			got = append(got, entry.TxID)
+		}
+		pages++
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	if pages != 2 || len(got) != len(want) {
+		t.Fatalf("%d transactions in %d pages, want %d in 2", len(got), pages, len(want))
+	}
+	//transactions of one block are in key order, not block order
+	for i := 0; i < len(want); i += 2 {
+		if !(bytes.Equal(got[i], want[i]) && bytes.Equal(got[i+1], want[i+1])) &&
+			!(bytes.Equal(got[i], want[i+1]) && bytes.Equal(got[i+1], want[i])) {
+			t.Fatalf("transactions %d and %d are not from the block at height %d", i, i+1, 3-i/2)
+		}
+	}
+
+	txs, proofs, err := chain.GetAddressProofs(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != len(want) {
+		t.Fatalf("%d proven transactions, want %d", len(txs), len(want))
+	}
+	for i, proof := range proofs {
+		if !bytes.Equal(proof.TxID, txs[i].ID) || !proof.Verify() {
+			t.Fatalf("proof of %x does not verify", txs[i].ID)
+		}
+	}
+}
+
+func TestAddressHistoryCoinbase(t *testing.T) {
+	chain, a := newTestChain(t)
+	forger := newTestWallet(t)
+
+	stake, err := NewTransaction(a, string(a.Address()), string(a.Address()), 10, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestBlock(t, chain, tipBlock(t, chain), a, 0, stake)
+	addTestBlock(t, chain, tipBlock(t, chain), forger, 0)
+
+	history, _, err := chain.GetAddressHistory(wallet.PublicKeyHash(a.Publickey), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbases := make(map[string]bool)
+	for _, entry := range history {
+		coinbases[string(entry.TxID)] = entry.Coinbase
+	}
+	if len(coinbases) != 3 {
+		t.Fatalf("%d transactions in the history, want 3", len(coinbases))
+	}
+	if coinbases[string(stake.ID)] {
+		t.Fatalf("stake transaction is marked as a coinbase")
+	}
+	for id, coinbase := range coinbases {
+		if id != string(stake.ID) && !coinbase {
+			t.Fatalf("coinbase %x is not marked as one", id)
+		}
+	}
+}
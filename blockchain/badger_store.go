@@ -0,0 +1,250 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgraph-io/badger"
+)
+
+type (
+	//BadgerStore is the ChainStore kept on disk in ./tmp/blocks_NODE_ID
+	BadgerStore struct {
+		DB *badger.DB
+	}
+
+	badgerTxn struct {
+		txn *badger.Txn
+	}
+
+	badgerBatch struct {
+		db   *badger.DB
+		txn  *badger.Txn
+		keys int
+	}
+)
+
+const (
+	collectSize = 100000
+	//gcDiscardRatio is the share of a value log file that has to be garbage
+	//for it to be rewritten
+	gcDiscardRatio = 0.5
+)
+
+func DBexists(path string) bool {
+	if _, err := os.Stat(path + "/MANIFEST"); os.IsNotExist(err) {
+		return false
+	}
+
+	return true
+}
+
+func retry(dir string, originalOpts badger.Options) (*badger.DB, error) {
+	fmt.Println("path - ", dir)
+	lockPath := filepath.Join(dir, "LOCK")
+	fmt.Println("lockPath - ", lockPath)
+	if err := os.Remove(lockPath); err != nil {
+		return nil, fmt.Errorf(`removing "LOCK": %s`, err)
+	}
+	retryOpts := originalOpts
+	retryOpts.Truncate = true
+	db, err := badger.Open(retryOpts)
+	return db, err
+}
+
+func openDB(dir string, opts badger.Options) (*badger.DB, error) {
+	if db, err := badger.Open(opts); err != nil {
+		if strings.Contains(err.Error(), "LOCK") {
+			if db, err := retry(dir, opts); err == nil {
+				log.Println("database unlocked, value log truncated")
+				return db, nil
+			}
+			log.Println("could not unlock database:", err)
+		}
+		return nil, err
+	} else {
+		return db, nil
+	}
+}
+
+//NewBadgerStore opens, or creates, the badger database in path
+func NewBadgerStore(path string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = path
+	opts.ValueDir = path
+
+	db, err := openDB(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BadgerStore{db}, nil
+}
+
+func (s *BadgerStore) GetBlock(hash []byte) (*Block, error) {
+	return storeGetBlock(s, hash)
+}
+
+func (s *BadgerStore) PutBlock(block *Block) error {
+	return storePutBlock(s, block)
+}
+
+func (s *BadgerStore) GetTip() ([]byte, error) {
+	return storeGetTip(s)
+}
+
+func (s *BadgerStore) SetTip(hash []byte) error {
+	return storeSetTip(s, hash)
+}
+
+func (s *BadgerStore) View(fn func(txn StoreTxn) error) error {
+	return s.DB.View(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+func (s *BadgerStore) Update(fn func(txn StoreTxn) error) error {
+	return s.DB.Update(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+func (s *BadgerStore) NewBatch() Batch {
+	return &badgerBatch{s.DB, s.DB.NewTransaction(true), 0}
+}
+
+//CollectGarbage runs the value log GC until it finds no file worth rewriting.
+//badger never gives back the space of deleted values without it
+func (s *BadgerStore) CollectGarbage() error {
+	for {
+		err := s.DB.RunValueLogGC(gcDiscardRatio)
+		if err == badger.ErrNoRewrite {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *BadgerStore) Close() error {
+	return s.DB.Close()
+}
+
+func (t badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+func (t badgerTxn) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (t badgerTxn) Iterate(prefix []byte, fn func(key, value []byte) bool) error {
+	it := t.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !fn(item.KeyCopy(nil), value) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (t badgerTxn) IterateReverse(prefix, before []byte, fn func(key, value []byte) bool) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	it := t.txn.NewIterator(opts)
+	defer it.Close()
+
+	//a reverse Seek stops at the last key not above start, start itself is
+	//skipped
+	start := before
+	if start == nil {
+		start = prefixEnd(prefix)
+	}
+	if start == nil {
+		it.Rewind()
+	} else if it.Seek(start); it.Valid() && bytes.Equal(it.Item().Key(), start) {
+		it.Next()
+	}
+
+	for ; it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !fn(item.KeyCopy(nil), value) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (b *badgerBatch) write(fn func(txn *badger.Txn) error) error {
+	if b.keys >= collectSize {
+		if err := b.commit(); err != nil {
+			return err
+		}
+	}
+
+	err := fn(b.txn)
+	if err == badger.ErrTxnTooBig {
+		if err := b.commit(); err != nil {
+			return err
+		}
+		err = fn(b.txn)
+	}
+	b.keys++
+
+	return err
+}
+
+func (b *badgerBatch) Set(key, value []byte) error {
+	return b.write(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (b *badgerBatch) Delete(key []byte) error {
+	return b.write(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (b *badgerBatch) commit() error {
+	if err := b.txn.Commit(nil); err != nil {
+		return err
+	}
+	b.txn = b.db.NewTransaction(true)
+	b.keys = 0
+
+	return nil
+}
+
+//Flush commits what is left in the batch
+func (b *badgerBatch) Flush() error {
+	return b.txn.Commit(nil)
+}
@@ -2,25 +2,21 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/gob"
-	"log"
 	"time"
 )
 
 type (
 	Block struct {
+		BlockHeader
 		Hash        []byte
 		Transaction []*Transaction
-		PrevHash    []byte
-		Height      int
-		Validator   string
-		Timestamp   int64
 	}
 )
 
-func CreateBlock(txs []*Transaction, prevHash []byte, Validator string, height int) *Block {
-	block := &Block{[]byte{}, txs, prevHash, height, Validator, time.Now().Unix()}
+func CreateBlock(txs []*Transaction, prevHash []byte, Validator string, height int, chainID string) *Block {
+	header := BlockHeader{BlockVersion, prevHash, nil, height, time.Now().Unix(), Validator, chainID}
+	block := &Block{header, []byte{}, txs}
+	block.MerkleRoot = block.HashTransactions()
 	//delete this and make function to generate Transactionhash
 	//Txhash is formed by SHA(Tx.ID) + Tx data
 	// pow := NewProof(block)
@@ -31,62 +27,61 @@ func CreateBlock(txs []*Transaction, prevHash []byte, Validator string, height i
 	return block
 }
 
+//BlockHashing is the hash of the header of the block
 func (b *Block) BlockHashing() []byte {
-	data := bytes.Join(
-		[][]byte{
-			b.PrevHash,
-			b.HashTransactions(),
-		},
-		[]byte{},
-	)
-
-	hash := sha256.Sum256(data)
-
-	return hash[:]
-}
-
-func Genesis(coinbase *Transaction, validator string) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{}, validator, 0)
+	return b.BlockHeader.Hash()
 }
 
 //turn Block to []byte data
 func (b *Block) Serialize() []byte {
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
+	return serialize(func(e *encoder) { e.writeBlock(b) })
+}
 
-	err := encoder.Encode(b)
+//Deserialize reads a block written by Serialize, or by the gob encoding
+//blocks were stored with before
+func Deserialize(data []byte) (*Block, error) {
+	if !isCanonical(data) {
+		return deserializeLegacyBlock(data)
+	}
 
+	d, err := newDecoder(data)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return res.Bytes()
-}
-
-func Deserialize(data []byte) *Block {
-	var block Block
-
-	//decode the data
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-
-	//pass the decoded data to block
-	err := decoder.Decode(&block)
-
-	Handler(err)
+	block := d.readBlock()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
 
-	return &block
+	return &block, nil
 }
 
-func (b *Block) HashTransactions() []byte {
+//merkleTree is built over the IDs of the transactions, which commit to the
+//whole signed transactions
+func (b *Block) merkleTree() *MerkleTree {
 	var (
 		txHashes [][]byte
 	)
 
 	for _, tx := range b.Transaction {
-		txHashes = append(txHashes, tx.Serialize())
+		txHashes = append(txHashes, tx.ID)
 	}
 
-	tree := NewMerkleTree(txHashes)
+	return NewMerkleTree(txHashes)
+}
+
+func (b *Block) HashTransactions() []byte {
+	return b.merkleTree().RootNode.Data
+}
+
+//MerkleProof returns the proof that the transaction with txID is in the block
+func (b *Block) MerkleProof(txID []byte) (MerkleProof, error) {
+	for i, tx := range b.Transaction {
+		if bytes.Equal(tx.ID, txID) {
+			return b.merkleTree().Proof(i)
+		}
+	}
 
-	return tree.RootNode.Data
+	return MerkleProof{}, ErrTxNotFound
 }
@@ -3,237 +3,375 @@ package blockchain
 import (
 	"bytes"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
-	"runtime"
-	"strings"
-
-	"github.com/dgraph-io/badger"
+	"sync"
 )
 
 type (
 	Blockchain struct {
 		LastHash []byte
-		Database *badger.DB
+		Database ChainStore
+		//Config is the genesis config the chain was made from
+		Config *GenesisConfig
+		//Base is the height of the oldest block the chain has. It is 0 unless
+		//the chain was started from a snapshot or pruned
+		Base int
+		//Prune is how many of the latest blocks a pruned chain keeps, 0 keeps
+		//every block
+		Prune int
+		//mutex is held by AddBlock from validation to connection, so blocks
+		//are checked against the tip they are connected to, and guards LastHash
+		mutex sync.RWMutex
 	}
 )
 
-const (
-	initialCoin = 20
-)
-
 var (
-	dbPath      = "./tmp/blocks_%s"
-	genesisData = "First Transaction from Genesis"
+	dbPath = "./tmp/blocks_%s"
 )
 
-func DBexists(path string) bool {
-	if _, err := os.Stat(path + "/MANIFEST"); os.IsNotExist(err) {
-		return false
-	}
+func InitBlockchain(address, nodeID string) (*Blockchain, error) {
+	return InitBlockchainFromConfig(nodeID, DefaultGenesisConfig(address))
+}
 
-	return true
+//InitBlockchainFromConfig creates the chain of nodeID from a genesis file
+func InitBlockchainFromConfig(nodeID string, config *GenesisConfig) (*Blockchain, error) {
+	return initBlockchain(nodeID, func(store ChainStore) (*Blockchain, error) {
+		return CreateBlockchainFromConfig(store, config)
+	})
 }
 
-func retry(dir string, originalOpts badger.Options) (*badger.DB, error) {
-	fmt.Println("path - ", dir)
-	lockPath := filepath.Join(dir, "LOCK")
-	fmt.Println("lockPath - ", lockPath)
-	if err := os.Remove(lockPath); err != nil {
-		return nil, fmt.Errorf(`removing "LOCK": %s`, err)
+//InitBlockchainFromGenesis creates the chain of nodeID from a genesis block
+//made by another node and the genesis file it was made from
+func InitBlockchainFromGenesis(nodeID string, genesis *Block, config *GenesisConfig) (*Blockchain, error) {
+	return initBlockchain(nodeID, func(store ChainStore) (*Blockchain, error) {
+		return CreateBlockchainFromGenesis(store, genesis, config)
+	})
+}
+
+func initBlockchain(nodeID string, create func(store ChainStore) (*Blockchain, error)) (*Blockchain, error) {
+	path := fmt.Sprintf(dbPath, nodeID)
+	if DBexists(path) {
+		return nil, ErrBlockchainExists
+	}
+
+	store, err := NewBadgerStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := create(store)
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
-	retryOpts := originalOpts
-	retryOpts.Truncate = true
-	db, err := badger.Open(retryOpts)
-	return db, err
+
+	return chain, nil
 }
 
-func openDB(dir string, opts badger.Options) (*badger.DB, error) {
-	if db, err := badger.Open(opts); err != nil {
-		if strings.Contains(err.Error(), "LOCK") {
-			if db, err := retry(dir, opts); err == nil {
-				log.Println("database unlocked, value log truncated")
-				return db, nil
-			}
-			log.Println("could not unlock database:", err)
-		}
+//CreateBlockchain writes the default genesis block paying address into an
+//empty store
+func CreateBlockchain(store ChainStore, address string) (*Blockchain, error) {
+	return CreateBlockchainFromConfig(store, DefaultGenesisConfig(address))
+}
+
+//CreateBlockchainFromConfig writes the genesis block of config into an empty
+//store
+func CreateBlockchainFromConfig(store ChainStore, config *GenesisConfig) (*Blockchain, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	genesis, err := config.Block()
+	if err != nil {
 		return nil, err
-	} else {
-		return db, nil
 	}
+	fmt.Println("Genesis created")
+
+	return writeGenesis(store, genesis, config)
 }
 
-func InitBlockchain(address, nodeID string) *Blockchain {
-	path := fmt.Sprintf(dbPath, nodeID)
-	if DBexists(path) {
-		fmt.Println("Blockchain already exists")
-		runtime.Goexit()
+//CreateBlockchainFromGenesis writes a genesis block made by another node into
+//an empty store. The block has to be the genesis block of config
+func CreateBlockchainFromGenesis(store ChainStore, genesis *Block, config *GenesisConfig) (*Blockchain, error) {
+	if config == nil {
+		return nil, ErrNoGenesisConfig
 	}
-	var lastHash []byte
-	opts := badger.DefaultOptions
-	opts.Dir = path
-	opts.ValueDir = path
 
-	db, err := openDB(path, opts)
-	Handler(err)
+	if err := ValidateGenesis(genesis); err != nil {
+		return nil, err
+	}
 
-	err = db.Update(func(txn *badger.Txn) error {
-		cbtx := CoinbaseTx(address, genesisData, 50)
-		genesis := Genesis(cbtx, address)
-		fmt.Println("Genesis created")
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.checkGenesis(genesis); err != nil {
+		return nil, err
+	}
 
-		hash := genesis.BlockHashing()
-		genesis.Hash = hash[:]
-		err = txn.Set(genesis.Hash, genesis.Serialize())
-		Handler(err)
-		err = txn.Set([]byte("lh"), genesis.Hash)
+	return writeGenesis(store, genesis, config)
+}
 
-		lastHash = genesis.Hash
+func writeGenesis(store ChainStore, genesis *Block, config *GenesisConfig) (*Blockchain, error) {
+	err := store.Update(func(txn StoreTxn) error {
+		if err := putBlock(txn, genesis); err != nil {
+			return err
+		}
 
-		return err
+		if config != nil {
+			if err := putGenesisConfig(txn, config); err != nil {
+				return err
+			}
+		}
 
+		return connectBlock(txn, genesis)
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	Handler(err)
-
-	blockchain := Blockchain{lastHash, db}
-	return &blockchain
+	return LoadBlockchain(store)
 }
 
-func NormalBlockchainProcess(nodeID string) *Blockchain {
-	var lastHash []byte
-
+func NormalBlockchainProcess(nodeID string) (*Blockchain, error) {
 	path := fmt.Sprintf(dbPath, nodeID)
 	if DBexists(path) == false {
-		fmt.Println("no existing blockchain found")
-		runtime.Goexit()
+		return nil, ErrNoBlockchain
+	}
+
+	store, err := NewBadgerStore(path)
+	if err != nil {
+		return nil, err
 	}
 
-	opts := badger.DefaultOptions
-	opts.Dir = path
-	opts.ValueDir = path
+	chain, err := LoadBlockchain(store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
 
-	db, err := openDB(path, opts)
-	Handler(err)
+	return chain, nil
+}
 
-	err = db.Update(func(txn *badger.Txn) error {
-		data, err := txn.Get([]byte("lh"))
-		Handler(err)
+//LoadBlockchain opens the chain already written in store
+func LoadBlockchain(store ChainStore) (*Blockchain, error) {
+	lastHash, err := store.GetTip()
+	if err == ErrKeyNotFound {
+		return nil, ErrNoBlockchain
+	} else if err != nil {
+		return nil, err
+	}
 
-		lastHash, err = data.Value()
+	var (
+		config      *GenesisConfig
+		base, prune int
+	)
+	err = store.View(func(txn StoreTxn) error {
+		if config, err = getGenesisConfig(txn); err != nil {
+			return err
+		}
+
+		if base, err = getBase(txn); err != nil {
+			return err
+		}
+
+		prune, err = getPruning(txn)
 		return err
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	Handler(err)
-
-	chain := Blockchain{lastHash, db}
+	chain := Blockchain{LastHash: lastHash, Database: store, Config: config, Base: base, Prune: prune}
 
-	return &chain
+	return &chain, nil
 }
 
-func (chain *Blockchain) FindUnspentTransactions(PubKeyHash []byte) []Transaction {
-	var unspentTx []Transaction
+//FindUTXO walks the whole chain and collects every unspent output, keyed by txid.
+//It is only used to rebuild the UTXO index, queries should go through UTXOSet
+func (chain *Blockchain) FindUTXO() (map[string]TxOutputs, error) {
+	if chain.Base > 0 {
+		return nil, ErrNoHistory
+	}
 
-	spentTXs := make(map[string][]int)
+	UTXO := make(map[string]TxOutputs)
+	spentTXOs := make(map[string][]int)
 
 	iter := chain.Iterate()
 
 	for {
-
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
 
 		for _, tx := range block.Transaction {
 			txID := hex.EncodeToString(tx.ID)
 
 		Outputs:
 			for outIdx, out := range tx.Outputs {
-				if spentTXs[txID] != nil {
-					for _, spentOut := range spentTXs[txID] {
+				if out.IsData() {
+					continue
+				}
+				if spentTXOs[txID] != nil {
+					for _, spentOut := range spentTXOs[txID] {
 						if spentOut == outIdx {
 							continue Outputs
 						}
 					}
 				}
-				fmt.Println("out data = ", out.PubKeyHash)
-				fmt.Println("PublicKeyHash = ", PubKeyHash)
-				if out.IsLockedWithKey(PubKeyHash) {
-					unspentTx = append(unspentTx, *tx)
-				}
+				outs := UTXO[txID]
+				outs.Outputs = append(outs.Outputs, out)
+				outs.Indexes = append(outs.Indexes, outIdx)
+				outs.Height = block.Height
+				outs.Coinbase = tx.IsCoinbase()
+				UTXO[txID] = outs
 			}
-			if tx.isCoinbase() == false {
+			if tx.IsCoinbase() == false {
 				for _, in := range tx.Inputs {
-					if in.UsesKey(PubKeyHash) {
-						inTxId := hex.EncodeToString(in.ID)
-						spentTXs[inTxId] = append(spentTXs[inTxId], in.Out)
-					}
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
 				}
 			}
 		}
 
-		if len(block.PrevHash) == 0 {
+		if iter.Done() {
 			break
 		}
 	}
-	return unspentTx
+	return UTXO, nil
 }
 
-func (chain *Blockchain) AddBlock(block *Block) {
-	err := chain.Database.Update(func(txn *badger.Txn) error {
-		if _, err := txn.Get(block.Hash); err == nil {
-			return nil
+//AddBlock validates block and stores it. The main chain is the highest one,
+//when block makes another branch higher the chain is reorganized onto it.
+//Blocks that are already stored are ignored
+func (chain *Blockchain) AddBlock(block *Block) error {
+	_, err := chain.ProcessBlock(block)
+	return err
+}
+
+//ProcessBlock is AddBlock that also returns how the main chain moved, for
+//the pending pool to follow it
+func (chain *Blockchain) ProcessBlock(block *Block) (TipUpdate, error) {
+	return chain.processBlock(block, false)
+}
+
+//processBlock is ProcessBlock that takes blocks of LegacyBlockVersion when
+//legacy is set, only for blocks from a source the user trusts
+func (chain *Blockchain) processBlock(block *Block, legacy bool) (TipUpdate, error) {
+	var (
+		update   TipUpdate
+		lastHash []byte
+	)
+
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if _, err := chain.GetBlock(block.Hash); err == nil {
+		return update, nil
+	}
+
+	if block.Version == LegacyBlockVersion {
+		if !legacy {
+			return update, ruleError(ErrBadVersion, "legacy block %x is only taken from an export", block.Hash)
+		}
+		if err := chain.checkLegacyBlock(block); err != nil {
+			return update, err
 		}
+	} else if err := chain.ValidateBlock(block); err != nil {
+		return update, err
+	}
 
-		blockData := block.Serialize()
-		err := txn.Set(block.Hash, blockData)
-		Handler(err)
+	err := chain.Database.Update(func(txn StoreTxn) error {
+		if err := putBlock(txn, block); err != nil {
+			return err
+		}
 
-		item, err := txn.Get([]byte("lh"))
-		Handler(err)
-		lastHash, _ := item.Value()
+		tip, err := getTip(txn)
+		if err != nil {
+			return err
+		}
+		lastHash = tip
 
-		item, err = txn.Get(lastHash)
-		Handler(err)
-		lastBlockData, _ := item.Value()
+		lastBlock, err := getBlock(txn, lastHash)
+		if err != nil {
+			return err
+		}
 
-		lastBlock := Deserialize(lastBlockData)
+		if block.Height <= lastBlock.Height {
+			return nil
+		}
 
-		if block.Height > lastBlock.Height {
-			err = txn.Set([]byte("lh"), block.Hash)
-			Handler(err)
-			chain.LastHash = block.Hash
+		if bytes.Equal(block.PrevHash, lastHash) {
+			err = chain.checkConnect(txn, block)
+			if err == nil {
+				err = connectBlock(txn, block)
+			}
+			update = TipUpdate{Connected: []*Block{block}}
+		} else {
+			update, err = chain.reorganize(txn, lastBlock, block)
 		}
+		lastHash = block.Hash
 
-		return nil
+		return err
 	})
-	Handler(err)
+	if err != nil {
+		return TipUpdate{}, err
+	}
+
+	chain.LastHash = lastHash
+
+	if chain.Prune > 0 {
+		if _, err := chain.PruneBlocks(); err != nil {
+			log.Printf("Could not prune blocks: %s\n", err)
+		}
+	}
+
+	return update, nil
 }
 
 func (chain *Blockchain) GetBlock(blockHash []byte) (Block, error) {
+	block, err := chain.Database.GetBlock(blockHash)
+	if err == ErrKeyNotFound {
+		return Block{}, ErrBlockNotFound
+	} else if err != nil {
+		return Block{}, err
+	}
+
+	return *block, nil
+}
+
+//GetBlockByHeight returns the block at height on the main chain
+func (chain *Blockchain) GetBlockByHeight(height int) (Block, error) {
 	var (
 		block Block
 	)
 
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		if item, err := txn.Get(blockHash); err != nil {
-			return errors.New("Block is not found")
-		} else {
-			blockData, _ := item.Value()
+	err := chain.Database.View(func(txn StoreTxn) error {
+		hash, err := txn.Get(heightKey(height))
+		if err == ErrKeyNotFound {
+			return ErrBlockNotFound
+		} else if err != nil {
+			return err
+		}
 
-			block = *Deserialize(blockData)
+		b, err := getBlock(txn, hash)
+		if err == ErrKeyNotFound {
+			return ErrBlockNotFound
+		} else if err != nil {
+			return err
 		}
+		block = *b
+
 		return nil
 	})
-	if err != nil {
-		return block, err
-	}
 
-	return block, nil
+	return block, err
 }
 
-func (chain *Blockchain) GetBlockHashes() [][]byte {
+//GetBlockHashes returns the hashes of the main chain blocks from the tip down
+//to height from
+func (chain *Blockchain) GetBlockHashes(from int) ([][]byte, error) {
 	var (
 		blocks [][]byte
 	)
@@ -241,111 +379,143 @@ func (chain *Blockchain) GetBlockHashes() [][]byte {
 	iter := chain.Iterate()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
 
 		blocks = append(blocks, block.Hash)
 
-		if len(block.PrevHash) == 0 {
+		if iter.Done() || block.Height <= from {
 			break
 		}
 	}
 
-	return blocks
+	return blocks, nil
 }
 
-func (chain *Blockchain) FindUTXO(pubKeyHash []byte) []TxOutput {
-	var UTXOs []TxOutput
-	unspentTransactions := chain.FindUnspentTransactions(pubKeyHash)
-
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
-	}
-	return UTXOs
+func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	tx, _, err := bc.findTransaction(ID)
+	return tx, err
 }
 
-func (chain *Blockchain) FindSpendableOutputs(PubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-	unspentTxs := chain.FindUnspentTransactions(PubKeyHash)
-	accumulated := 0
+//prevTransaction finds the transaction in spends from, see utxoTransaction
+func (bc *Blockchain) prevTransaction(in TxInput) (Transaction, error) {
+	var tx Transaction
 
-Work:
-	for _, tx := range unspentTxs {
-		txID := hex.EncodeToString(tx.ID)
+	err := bc.Database.View(func(txn StoreTxn) error {
+		var err error
+		tx, _, err = utxoTransaction(txn, in)
+		return err
+	})
 
-		for outIdx, out := range tx.Outputs {
-			//to validate so the user wont be able to sent money if they didnt have enough balances
-			if out.IsLockedWithKey(PubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+	return tx, err
+}
 
-				if accumulated >= amount {
-					break Work
-				}
-			}
+//utxoTransaction reads the transaction in spends from the UTXO index, which
+//also has the outputs of the blocks a chain started from a snapshot does not
+//have, with the entry it was read from. Only its unspent outputs are set, an
+//output that is spent or was never created is ErrMissingInput
+func utxoTransaction(txn StoreTxn, in TxInput) (Transaction, TxOutputs, error) {
+	var tx Transaction
+
+	v, err := txn.Get(utxoKey(in.ID))
+	if err == ErrKeyNotFound {
+		return tx, TxOutputs{}, ruleError(ErrMissingInput, "%x:%d", in.ID, in.Out)
+	} else if err != nil {
+		return tx, TxOutputs{}, err
+	}
+	outs, err := DeserializeOutputs(v)
+	if err != nil {
+		return tx, outs, err
+	}
+
+	found := false
+	tx.ID = in.ID
+	for i, idx := range outs.Indexes {
+		for len(tx.Outputs) <= idx {
+			tx.Outputs = append(tx.Outputs, TxOutput{})
 		}
+		tx.Outputs[idx] = outs.Outputs[i]
+		found = found || idx == in.Out
+	}
+	if !found {
+		return tx, outs, ruleError(ErrMissingInput, "%x:%d", in.ID, in.Out)
 	}
 
-	return accumulated, unspentOuts
+	return tx, outs, nil
 }
 
-func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
-	iter := bc.Iterate()
+//VerifyTransaction returns nil when every input of tx refers to a known
+//transaction, carries a valid signature and could be spent in the next block
+func (bc *Blockchain) VerifyTransaction(tx *Transaction) error {
+	_, err := bc.TransactionFee(tx)
+	return err
+}
 
-	for {
-		block := iter.Next()
+//TransactionFee verifies tx like VerifyTransaction and returns its fee
+func (bc *Blockchain) TransactionFee(tx *Transaction) (int, error) {
+	fee := 0
 
-		for _, tx := range block.Transaction {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
+	err := bc.Database.View(func(txn StoreTxn) error {
+		next, err := bc.tipSpendContext(txn)
+		if err != nil {
+			return err
 		}
 
-		if len(block.PrevHash) == 0 {
-			break
-		}
-	}
+		fee, err = bc.verifyBlockTransaction(txn, tx, nil, next)
+		return err
+	})
 
-	return Transaction{}, errors.New("Transaction does not exist")
+	return fee, err
 }
 
-func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
+func (chain *Blockchain) GetLastHeight() (int, error) {
+	var lastBlock *Block
 
-	if tx.isCoinbase() {
-		return true
-	}
-
-	prevTxs := make(map[string]Transaction)
+	err := chain.Database.View(func(txn StoreTxn) error {
+		lastHash, err := getTip(txn)
+		if err != nil {
+			return err
+		}
 
-	for _, in := range tx.Inputs {
-		prevTx, err := bc.FindTransaction(in.ID)
-		Handler(err)
-		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
+		lastBlock, err = getBlock(txn, lastHash)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return tx.Verify(prevTxs)
+	return lastBlock.Height, nil
 }
 
-func (chain *Blockchain) GetLastHeight() int {
-	var lastBlock Block
-
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handler(err)
-		lastHash, _ := item.Value()
-
-		item, err = txn.Get(lastHash)
-		Handler(err)
-		lastBlockData, _ := item.Value()
-
-		lastBlock = *Deserialize(lastBlockData)
+//DeleteByPrefix removes every key starting with prefix in batches
+func (chain *Blockchain) DeleteByPrefix(prefix []byte) error {
+	for {
+		var keysForDelete [][]byte
+
+		err := chain.Database.View(func(txn StoreTxn) error {
+			return txn.Iterate(prefix, func(key, value []byte) bool {
+				keysForDelete = append(keysForDelete, key)
+				return len(keysForDelete) < collectSize
+			})
+		})
+		if err != nil {
+			return err
+		}
 
-		return nil
-	})
-	Handler(err)
+		if len(keysForDelete) == 0 {
+			return nil
+		}
 
-	return lastBlock.Height
+		batch := chain.Database.NewBatch()
+		for _, key := range keysForDelete {
+			if err := batch.Delete(key); err != nil {
+				return err
+			}
+		}
+		if err := batch.Flush(); err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,212 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func newTestWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+
+	w, err := wallet.MakeWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+//newTestChain is a chain in memory whose genesis pays defaultAllocation to a
+//new wallet
+func newTestChain(t *testing.T) (*Blockchain, *wallet.Wallet) {
+	t.Helper()
+
+	w := newTestWallet(t)
+	chain, err := CreateBlockchain(NewMemoryStore(), string(w.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain, w
+}
+
+func tipBlock(t *testing.T, chain *Blockchain) *Block {
+	t.Helper()
+
+	block, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &block
+}
+
+//newTestBlock builds a block on parent whose coinbase pays reward to forger
+func newTestBlock(t *testing.T, parent *Block, forger *wallet.Wallet, reward int, txs ...*Transaction) *Block {
+	t.Helper()
+
+	coinbase, err := CoinbaseTx(string(forger.Address()), "", reward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := CreateBlock(append([]*Transaction{coinbase}, txs...), parent.Hash, "", parent.Height+1, parent.ChainID)
+	block.Hash = block.BlockHashing()
+	return block
+}
+
+//addTestBlock adds a block on parent paying the subsidy and fees to forger
+func addTestBlock(t *testing.T, chain *Blockchain, parent *Block, forger *wallet.Wallet, fees int, txs ...*Transaction) *Block {
+	t.Helper()
+
+	block := newTestBlock(t, parent, forger, chain.Config.BlockSubsidy(parent.Height+1)+fees, txs...)
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatalf("block %d: %s", block.Height, err)
+	}
+	return block
+}
+
+//spendOutput pays amount from output out of prev, owned by from, to to. The
+//rest less fee goes back to from
+func spendOutput(t *testing.T, from *wallet.Wallet, prev *Transaction, out int, to *wallet.Wallet, amount, fee int) *Transaction {
+	t.Helper()
+
+	output, err := NewTxOutput(amount, string(to.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := Transaction{nil, []TxInput{{prev.ID, string(from.Address()), out, nil, from.Publickey, nil, nil}}, []TxOutput{*output}, 0}
+	if change := prev.Outputs[out].Value - amount - fee; change > 0 {
+		back, err := NewTxOutput(change, string(from.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Outputs = append(tx.Outputs, *back)
+	}
+
+	if err := tx.Sign(from.PrivateKey, map[string]Transaction{hex.EncodeToString(prev.ID): *prev}); err != nil {
+		t.Fatal(err)
+	}
+	tx.ID = tx.Hash()
+	return &tx
+}
+
+func balance(t *testing.T, chain *Blockchain, w *wallet.Wallet) int {
+	t.Helper()
+
+	outs, err := UTXOSet{chain}.FindUTXO(wallet.PublicKeyHash(w.Publickey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, out := range outs {
+		total += out.Value
+	}
+	return total
+}
+
+func TestVerifyTransactionSpentOutput(t *testing.T) {
+	chain, a := newTestChain(t)
+	b := newTestWallet(t)
+
+	tx, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.VerifyTransaction(tx); err != nil {
+		t.Fatalf("unconfirmed transaction: %s", err)
+	}
+
+	addTestBlock(t, chain, tipBlock(t, chain), b, 1, tx)
+
+	if err := chain.VerifyTransaction(tx); !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("confirmed transaction verified again: got %v, want %v", err, ErrMissingInput)
+	}
+	if _, err := chain.TransactionFee(tx); !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("fee of a confirmed transaction: got %v, want %v", err, ErrMissingInput)
+	}
+}
+
+func TestCheckConnectFees(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+	genesis := tipBlock(t, chain)
+	subsidy := chain.Config.BlockSubsidy(1)
+
+	tx := spendOutput(t, a, genesis.Transaction[0], 0, b, 10, 3)
+	greedy := newTestBlock(t, genesis, forger, subsidy+4, tx)
+	if err := chain.AddBlock(greedy); !errors.Is(err, ErrBadReward) {
+		t.Fatalf("coinbase above subsidy and fees: got %v, want %v", err, ErrBadReward)
+	}
+
+	overspend := spendOutput(t, a, genesis.Transaction[0], 0, b, defaultAllocation+1, 0)
+	block := newTestBlock(t, genesis, forger, subsidy, overspend)
+	if err := chain.AddBlock(block); !errors.Is(err, ErrBadFee) {
+		t.Fatalf("outputs above inputs: got %v, want %v", err, ErrBadFee)
+	}
+
+	addTestBlock(t, chain, genesis, forger, 3, tx)
+	if got, want := balance(t, chain, forger), subsidy+3; got != want {
+		t.Fatalf("forger got %d, want subsidy and fees %d", got, want)
+	}
+}
+
+func TestAddBlockConcurrent(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, c, forger := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	//both blocks spend the genesis output, only one can be connected
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toC, err := NewTransaction(a, string(a.Address()), string(c.Address()), 10, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*Block{
+		newTestBlock(t, genesis, forger, chain.Config.BlockSubsidy(1), toB),
+		newTestBlock(t, genesis, forger, chain.Config.BlockSubsidy(1), toC),
+	}
+
+	var wg sync.WaitGroup
+	for _, block := range blocks {
+		wg.Add(1)
+		go func(block *Block) {
+			defer wg.Done()
+			if err := chain.AddBlock(block); err != nil {
+				t.Error(err)
+			}
+			chain.Iterate()
+		}(block)
+	}
+	wg.Wait()
+
+	if got := balance(t, chain, b) + balance(t, chain, c); got != 10 {
+		t.Fatalf("b and c hold %d, want 10", got)
+	}
+	if got := balance(t, chain, a); got != 40 {
+		t.Fatalf("balance of a is %d, want 40", got)
+	}
+}
+
+func TestCorruptIndexEntry(t *testing.T) {
+	chain, a := newTestChain(t)
+	genesis := tipBlock(t, chain)
+	coinbase := genesis.Transaction[0]
+
+	err := chain.Database.Update(func(txn StoreTxn) error {
+		return txn.Set(utxoKey(coinbase.ID), []byte("corrupt"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := chain.TransactionFee(spendOutput(t, a, coinbase, 0, a, 10, 1)); err == nil {
+		t.Fatalf("transaction spending a corrupt UTXO entry is valid")
+	}
+	if _, err := (&UTXOSet{chain}).FindUTXO(wallet.PublicKeyHash(a.Publickey)); err == nil {
+		t.Fatalf("corrupt UTXO entry is read")
+	}
+}
@@ -1,38 +1,40 @@
 package blockchain
 
-import "github.com/dgraph-io/badger"
-
 type (
 	BlockchainIterate struct {
 		CurrentHash []byte
-		Database    *badger.DB
+		Database    ChainStore
+		//base is the height of the oldest block the chain has
+		base int
+		done bool
 	}
 )
 
 func (chain *Blockchain) Iterate() *BlockchainIterate {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
 
-	iter := &BlockchainIterate{chain.LastHash, chain.Database}
+	iter := &BlockchainIterate{CurrentHash: chain.LastHash, Database: chain.Database, base: chain.Base}
 	return iter
 }
 
-func (iter *BlockchainIterate) Next() *Block {
-	var (
-		block        *Block
-		encodedBlock []byte
-	)
-
-	err := iter.Database.View(func(txn *badger.Txn) error {
-		//get the block based on currenthash
-		data, err := txn.Get(iter.CurrentHash)
-		encodedBlock, err = data.Value()
-		block = Deserialize(encodedBlock)
-
-		return err
-	})
-
-	Handler(err)
+func (iter *BlockchainIterate) Next() (*Block, error) {
+	//get the block based on currenthash
+	block, err := iter.Database.GetBlock(iter.CurrentHash)
+	if err == ErrKeyNotFound {
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, err
+	}
 
 	iter.CurrentHash = block.PrevHash
+	iter.done = len(block.PrevHash) == 0 || block.Height <= iter.base
+
+	return block, nil
+}
 
-	return block
+//Done reports whether the last block returned is the oldest one of the
+//chain: the genesis block, or the block a snapshot was taken at
+func (iter *BlockchainIterate) Done() bool {
+	return iter.done
 }
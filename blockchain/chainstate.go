@@ -0,0 +1,209 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+)
+
+type (
+	//SpentOutput is an output that a block spent, kept to undo the block
+	SpentOutput struct {
+		TxID   []byte
+		Index  int
+		Output TxOutput
+		//Height is the height of the block that confirmed the output
+		Height int
+		//Coinbase tells whether the output was paid by a coinbase
+		Coinbase bool
+	}
+
+	BlockUndo struct {
+		Spent []SpentOutput
+	}
+
+	//TipUpdate is how ProcessBlock moved the main chain. Both are empty when
+	//the block was stored on a branch that is not higher
+	TipUpdate struct {
+		//Connected are the blocks that joined the main chain, oldest first
+		Connected []*Block
+		//Disconnected are the blocks that left it, newest first
+		Disconnected []*Block
+	}
+)
+
+const (
+	//MaxReorgDepth is how many blocks a reorganization can disconnect. The
+	//whole reorganization runs in one store transaction, which has to stay
+	//small enough for the store to commit
+	MaxReorgDepth = 100
+)
+
+var (
+	ErrReorgTooDeep  = errors.New("branch forks off deeper than the chain reorganizes")
+	ErrForkBelowBase = errors.New("branch forks off below the base of the chain")
+
+	//undo-<blockhash> holds the outputs spent by a block on the main chain
+	undoPrefix = []byte("undo-")
+	//height-<height> holds the hash of the main chain block at that height
+	heightPrefix = []byte("height-")
+)
+
+func undoKey(hash []byte) []byte {
+	return append(append([]byte{}, undoPrefix...), hash...)
+}
+
+func heightKey(height int) []byte {
+	return append(append([]byte{}, heightPrefix...), ToHex(int64(height))...)
+}
+
+func (u BlockUndo) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(u)
+	return buffer.Bytes(), err
+}
+
+func DeserializeUndo(data []byte) (BlockUndo, error) {
+	var undo BlockUndo
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&undo)
+	return undo, err
+}
+
+//connectBlock makes block, whose parent is the current tip, the new tip
+func connectBlock(txn StoreTxn, block *Block) error {
+	spent, err := updateUTXO(txn, block)
+	if err != nil {
+		return err
+	}
+
+	undoData, err := BlockUndo{spent}.Serialize()
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(undoKey(block.Hash), undoData); err != nil {
+		return err
+	}
+
+	if err := txn.Set(heightKey(block.Height), block.Hash); err != nil {
+		return err
+	}
+
+	if err := indexTransactions(txn, block); err != nil {
+		return err
+	}
+
+	if err := indexAddresses(txn, block, spent); err != nil {
+		return err
+	}
+
+	if err := indexData(txn, block); err != nil {
+		return err
+	}
+
+	return setTip(txn, block.Hash)
+}
+
+//disconnectBlock removes the current tip and makes its parent the tip again
+func disconnectBlock(txn StoreTxn, block *Block) error {
+	undoData, err := txn.Get(undoKey(block.Hash))
+	if err != nil {
+		return err
+	}
+
+	undo, err := DeserializeUndo(undoData)
+	if err != nil {
+		return err
+	}
+	spent := undo.Spent
+
+	if err := revertUTXO(txn, block, spent); err != nil {
+		return err
+	}
+
+	if err := unindexAddresses(txn, block, spent); err != nil {
+		return err
+	}
+
+	if err := unindexData(txn, block); err != nil {
+		return err
+	}
+
+	if err := txn.Delete(undoKey(block.Hash)); err != nil {
+		return err
+	}
+
+	if err := txn.Delete(heightKey(block.Height)); err != nil {
+		return err
+	}
+
+	if err := unindexTransactions(txn, block); err != nil {
+		return err
+	}
+
+	return setTip(txn, block.PrevHash)
+}
+
+//reorganize switches the main chain from tip to the branch ending in block.
+//Blocks are disconnected back to the common ancestor and the branch is
+//checked and connected on top of it, all inside txn so a failure leaves the
+//chain as it was. Branches that fork off more than MaxReorgDepth blocks
+//below the tip or below the base of the chain are refused
+func (chain *Blockchain) reorganize(txn StoreTxn, tip, block *Block) (TipUpdate, error) {
+	var (
+		detach []*Block
+		attach []*Block
+	)
+
+	oldBranch, newBranch := tip, block
+	for !bytes.Equal(oldBranch.Hash, newBranch.Hash) {
+		var err error
+
+		if newBranch.Height >= oldBranch.Height {
+			if newBranch.Height <= chain.Base {
+				return TipUpdate{}, fmt.Errorf("%w: %x", ErrForkBelowBase, block.Hash)
+			}
+			attach = append(attach, newBranch)
+			newBranch, err = getBlock(txn, newBranch.PrevHash)
+		} else {
+			if oldBranch.Height <= chain.Base {
+				return TipUpdate{}, fmt.Errorf("%w: %x", ErrForkBelowBase, block.Hash)
+			}
+			if len(detach) == MaxReorgDepth {
+				return TipUpdate{}, fmt.Errorf("%w: %x", ErrReorgTooDeep, block.Hash)
+			}
+			detach = append(detach, oldBranch)
+			oldBranch, err = getBlock(txn, oldBranch.PrevHash)
+		}
+		if err != nil {
+			return TipUpdate{}, err
+		}
+	}
+
+	for _, b := range detach {
+		if err := disconnectBlock(txn, b); err != nil {
+			return TipUpdate{}, err
+		}
+	}
+
+	update := TipUpdate{Disconnected: detach}
+	for i := len(attach) - 1; i >= 0; i-- {
+		if err := chain.checkConnect(txn, attach[i]); err != nil {
+			return TipUpdate{}, err
+		}
+		if err := connectBlock(txn, attach[i]); err != nil {
+			return TipUpdate{}, err
+		}
+		update.Connected = append(update.Connected, attach[i])
+	}
+
+	if len(detach) > 0 {
+		log.Printf("Chain reorganized at %x: depth %d, %d blocks connected, new tip %x\n",
+			oldBranch.Hash, len(detach), len(attach), block.Hash)
+	}
+
+	return update, nil
+}
@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestGetBlockByHeightReorganize(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger, other := newTestWallet(t), newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	m1 := addTestBlock(t, chain, genesis, forger, 0)
+	m2 := addTestBlock(t, chain, m1, forger, 0)
+
+	s1 := addTestBlock(t, chain, genesis, other, 0)
+	s2 := addTestBlock(t, chain, s1, other, 0)
+	checkHeights := func(want ...*Block) {
+		t.Helper()
+		for height, block := range want {
+			got, err := chain.GetBlockByHeight(height)
+			if err != nil {
+				t.Fatalf("height %d: %s", height, err)
+			}
+			if !bytes.Equal(got.Hash, block.Hash) {
+				t.Fatalf("height %d is %x, want %x", height, got.Hash, block.Hash)
+			}
+		}
+		if _, err := chain.GetBlockByHeight(len(want)); err == nil {
+			t.Fatalf("found a block at height %d above the tip", len(want))
+		}
+	}
+	checkHeights(genesis, m1, m2)
+
+	s3 := addTestBlock(t, chain, s2, other, 0)
+	checkHeights(genesis, s1, s2, s3)
+}
+
+func TestReorganizeBranchSpendsItsOwnOutputs(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, c, d, forger := newTestWallet(t), newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toC, err := NewTransaction(a, string(a.Address()), string(c.Address()), 20, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m1 := addTestBlock(t, chain, genesis, forger, 1, toB)
+	m2 := addTestBlock(t, chain, m1, forger, 0)
+
+	//the branch spends in s2 the output s1 paid to c
+	s1 := addTestBlock(t, chain, genesis, forger, 1, toC)
+	toD := spendOutput(t, c, toC, 0, d, 5, 1)
+	s2 := addTestBlock(t, chain, s1, forger, 1, toD)
+	if !bytes.Equal(chain.LastHash, m2.Hash) {
+		t.Fatalf("tip moved to a branch that is not higher")
+	}
+	s3 := addTestBlock(t, chain, s2, forger, 0)
+
+	if !bytes.Equal(chain.LastHash, s3.Hash) {
+		t.Fatalf("tip is %x, want %x", chain.LastHash, s3.Hash)
+	}
+	for _, want := range []struct {
+		name  string
+		got   int
+		value int
+	}{
+		{"a", balance(t, chain, a), 29},
+		{"b", balance(t, chain, b), 0},
+		{"c", balance(t, chain, c), 14},
+		{"d", balance(t, chain, d), 5},
+	} {
+		if want.got != want.value {
+			t.Errorf("balance of %s is %d, want %d", want.name, want.got, want.value)
+		}
+	}
+}
+
+func TestReorganizeRollsBackInvalidBranch(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := addTestBlock(t, chain, genesis, forger, 1, toB)
+	m2 := addTestBlock(t, chain, m1, forger, 0)
+
+	//s2 spends an output the branch never created, which is only found when
+	//the branch is connected
+	s1 := addTestBlock(t, chain, genesis, forger, 0)
+	s2 := newTestBlock(t, s1, forger, chain.Config.BlockSubsidy(2), spendOutput(t, a, toB, 1, b, 1, 0))
+	if err := chain.AddBlock(s2); err != nil {
+		t.Fatalf("side block is checked against the main chain: %s", err)
+	}
+	s3 := newTestBlock(t, s2, forger, chain.Config.BlockSubsidy(3))
+	if err := chain.AddBlock(s3); !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("got %v, want %v", err, ErrMissingInput)
+	}
+
+	if !bytes.Equal(chain.LastHash, m2.Hash) {
+		t.Fatalf("tip is %x, want %x", chain.LastHash, m2.Hash)
+	}
+	if got := balance(t, chain, b); got != 10 {
+		t.Fatalf("balance of b is %d after the failed reorganization, want 10", got)
+	}
+	if _, err := chain.GetBlock(s3.Hash); err == nil {
+		t.Fatalf("block of the failed reorganization is stored")
+	}
+}
+
+//addTestBranch adds count empty blocks on parent and returns the last one
+func addTestBranch(t *testing.T, chain *Blockchain, parent *Block, forger *wallet.Wallet, count int) *Block {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		parent = addTestBlock(t, chain, parent, forger, 0)
+	}
+	return parent
+}
+
+func TestReorganizeDepth(t *testing.T) {
+	store, err := NewBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	a, forger := newTestWallet(t), newTestWallet(t)
+	chain, err := CreateBlockchain(store, string(a.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := tipBlock(t, chain)
+
+	//the deepest reorganization fits in one store transaction
+	addTestBranch(t, chain, genesis, forger, MaxReorgDepth)
+	tip := addTestBranch(t, chain, genesis, forger, MaxReorgDepth+1)
+	if !bytes.Equal(chain.LastHash, tip.Hash) {
+		t.Fatalf("tip is %x, want %x", chain.LastHash, tip.Hash)
+	}
+
+	last := addTestBranch(t, chain, genesis, forger, MaxReorgDepth+1)
+	block := newTestBlock(t, last, forger, chain.Config.BlockSubsidy(last.Height+1))
+	if err := chain.AddBlock(block); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("got %v, want %v", err, ErrReorgTooDeep)
+	}
+	if !bytes.Equal(chain.LastHash, tip.Hash) {
+		t.Fatalf("tip is %x, want %x", chain.LastHash, tip.Hash)
+	}
+}
+
+func TestReorganizeBelowBase(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger := newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	tip := addTestBranch(t, chain, genesis, forger, 15)
+	side := addTestBranch(t, chain, genesis, forger, 3)
+	if _, err := chain.SetPruning(MinPruneKeep); err != nil {
+		t.Fatal(err)
+	}
+
+	side = addTestBranch(t, chain, side, forger, tip.Height-side.Height)
+	block := newTestBlock(t, side, forger, chain.Config.BlockSubsidy(side.Height+1))
+	if err := chain.AddBlock(block); !errors.Is(err, ErrForkBelowBase) {
+		t.Fatalf("got %v, want %v", err, ErrForkBelowBase)
+	}
+	if !bytes.Equal(chain.LastHash, tip.Hash) {
+		t.Fatalf("tip is %x, want %x", chain.LastHash, tip.Hash)
+	}
+}
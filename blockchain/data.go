@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"github.com/test-blockchain/wallet"
+)
+
+type (
+	//DataAnchor is where a payload of a data output was confirmed
+	DataAnchor struct {
+		TxID      []byte
+		BlockHash []byte
+		Height    int
+		Timestamp int64
+	}
+)
+
+const (
+	//MaxDataSize is the most bytes a data output carries
+	MaxDataSize = 80
+)
+
+var (
+	//data-<sha256 of payload><height><txid> holds the DataAnchor of a main
+	//chain data output
+	dataIndexPrefix = []byte("data-")
+
+	errNotData = errors.New("not a single push of at most 80 bytes after OP_RETURN")
+)
+
+func dataIndexKey(data []byte, height int, txID []byte) []byte {
+	hash := sha256.Sum256(data)
+	key := append(append([]byte{}, dataIndexPrefix...), hash[:]...)
+	key = append(key, ToHex(int64(height))...)
+	return append(key, txID...)
+}
+
+func (a DataAnchor) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(a)
+	return buffer.Bytes(), err
+}
+
+func DeserializeDataAnchor(data []byte) (DataAnchor, error) {
+	var anchor DataAnchor
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&anchor)
+	return anchor, err
+}
+
+//NewDataOutput carries data in an output nobody can spend: its script starts
+//with OP_RETURN, so it is worth nothing and never enters the UTXO index
+func NewDataOutput(data []byte) (*TxOutput, error) {
+	if len(data) > MaxDataSize {
+		return nil, fmt.Errorf("data of %d bytes, at most %d", len(data), MaxDataSize)
+	}
+	script := appendPush([]byte{OP_RETURN}, data)
+
+	return &TxOutput{0, "", wallet.PublicKeyHash(script), 0, script}, nil
+}
+
+//IsData tells whether out is a data output, whatever its script holds next
+func (out *TxOutput) IsData() bool {
+	return len(out.Script) > 0 && out.Script[0] == OP_RETURN
+}
+
+//Data returns the payload of a data output written by NewDataOutput
+func (out *TxOutput) Data() ([]byte, error) {
+	if !out.IsData() || len(out.Script) < 2 || !isPush(out.Script[1]) {
+		return nil, errNotData
+	}
+	data, next, err := readPush(out.Script, 1)
+	if err != nil {
+		return nil, err
+	}
+	if next != len(out.Script) || len(data) > MaxDataSize {
+		return nil, errNotData
+	}
+
+	return data, nil
+}
+
+//checkDataOutputs checks that tx has at most one data output, worth nothing
+//and holding a single push of at most MaxDataSize bytes
+func checkDataOutputs(tx *Transaction) error {
+	found := false
+
+	for i, out := range tx.Outputs {
+		if !out.IsData() {
+			continue
+		}
+		if found {
+			return ruleError(ErrBadDataOutput, "%x has more than one", tx.ID)
+		}
+		found = true
+
+		if _, err := out.Data(); err != nil {
+			return ruleError(ErrBadDataOutput, "%x:%d: %s", tx.ID, i, err)
+		}
+		if out.Value != 0 || out.LockBlocks != 0 {
+			return ruleError(ErrBadDataOutput, "%x:%d carries a value", tx.ID, i)
+		}
+	}
+
+	return nil
+}
+
+//indexData records the payload of every data output of a connected block
+func indexData(txn StoreTxn, block *Block) error {
+	for _, tx := range block.Transaction {
+		for _, out := range tx.Outputs {
+			data, err := out.Data()
+			if err != nil {
+				continue
+			}
+			entry, err := DataAnchor{tx.ID, block.Hash, block.Height, block.Timestamp}.Serialize()
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(dataIndexKey(data, block.Height, tx.ID), entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func unindexData(txn StoreTxn, block *Block) error {
+	for _, tx := range block.Transaction {
+		for _, out := range tx.Outputs {
+			data, err := out.Data()
+			if err != nil {
+				continue
+			}
+			if err := txn.Delete(dataIndexKey(data, block.Height, tx.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//GetDataAnchors returns the main chain transactions that carry data, the
+//first one to anchor it first
+func (chain *Blockchain) GetDataAnchors(data []byte) ([]DataAnchor, error) {
+	var anchors []DataAnchor
+
+	hash := sha256.Sum256(data)
+	prefix := append(append([]byte{}, dataIndexPrefix...), hash[:]...)
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		var err error
+
+		iterErr := txn.Iterate(prefix, func(key, value []byte) bool {
+			var anchor DataAnchor
+			if anchor, err = DeserializeDataAnchor(value); err != nil {
+				return false
+			}
+			anchors = append(anchors, anchor)
+			return true
+		})
+		if iterErr != nil {
+			return iterErr
+		}
+
+		return err
+	})
+
+	return anchors, err
+}
@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDataOutput(t *testing.T) {
+	data := bytes.Repeat([]byte{0xab}, MaxDataSize)
+	out, err := NewDataOutput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.IsData() || out.Value != 0 {
+		t.Fatal("data output is not a data output worth nothing")
+	}
+	if got, err := out.Data(); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("data %x, %v, want %x", got, err, data)
+	}
+	if _, err := NewDataOutput(append(data, 0)); err == nil {
+		t.Fatalf("data output of %d bytes made", MaxDataSize+1)
+	}
+
+	//a data output followed by more opcodes
+	out.Script = append(out.Script, OP_1)
+	if _, err := out.Data(); err == nil {
+		t.Fatal("data read from a script with more than one push")
+	}
+
+	empty, err := NewDataOutput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valued := *empty
+	valued.Value = 1
+	for name, outputs := range map[string][]TxOutput{
+		"two data outputs": {*empty, *empty},
+		"value":            {valued},
+	} {
+		if err := checkDataOutputs(&Transaction{Outputs: outputs}); !errors.Is(err, ErrBadDataOutput) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrBadDataOutput)
+		}
+	}
+	if err := checkDataOutputs(&Transaction{Outputs: []TxOutput{*empty}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataAnchors(t *testing.T) {
+	chain, a := newTestChain(t)
+	forger := newTestWallet(t)
+	genesis := tipBlock(t, chain)
+	data := []byte("document hash")
+
+	tx, err := NewDataTransaction(a, string(a.Address()), "", 0, data, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := addTestBlock(t, chain, genesis, forger, 1, tx)
+
+	anchors, err := chain.GetDataAnchors(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anchors) != 1 || !bytes.Equal(anchors[0].TxID, tx.ID) || !bytes.Equal(anchors[0].BlockHash, m1.Hash) || anchors[0].Height != 1 {
+		t.Fatalf("anchors %+v, want %x in block 1", anchors, tx.ID)
+	}
+	for i, out := range tx.Outputs {
+		unspent, err := UTXOSet{chain}.IsUnspent(tx.ID, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.IsData() && unspent {
+			t.Fatal("data output in the UTXO set")
+		}
+	}
+	if got := balance(t, chain, a); got != defaultAllocation-1 {
+		t.Fatalf("balance of a is %d, want %d", got, defaultAllocation-1)
+	}
+
+	//a longer branch without the transaction drops the anchor
+	s1 := addTestBlock(t, chain, genesis, forger, 0)
+	addTestBlock(t, chain, s1, forger, 0)
+	if anchors, err := chain.GetDataAnchors(data); err != nil || len(anchors) != 0 {
+		t.Fatalf("anchors %+v, %v after a reorganization, want none", anchors, err)
+	}
+}
@@ -0,0 +1,307 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//Blocks, headers and transactions are stored and hashed in a canonical binary
+//encoding instead of gob so any client can reproduce their hashes:
+//
+//	int     8 bytes, big endian, two's complement
+//	[]byte  4 bytes big endian length followed by the bytes
+//	string  encoded as []byte
+//	list    4 bytes big endian count followed by the items
+//
+//Fields are written in the order they are declared in. A serialized object
+//starts with encodingMagic and the encoding version, hashes are computed over
+//the encoding without them. Fields added by a version are only written from
+//that version on, and a transaction is hashed with the first version that
+//holds all of its fields so older transactions keep their IDs
+
+type (
+	//encoder writes the fields of version, EncodingVersion unless set
+	//otherwise
+	encoder struct {
+		buffer  bytes.Buffer
+		version byte
+	}
+
+	//decoder remembers the first error so fields can be read without checking
+	//every one of them
+	decoder struct {
+		reader  *bytes.Reader
+		version byte
+		err     error
+	}
+)
+
+const (
+	//encodingMagic can never start a gob stream, which starts with a message
+	//length below 0x80 or a byte count of 0xf8 and above
+	encodingMagic = 0xc1
+	//EncodingVersion 2 added the lock times of transactions and outputs, 3 the
+	//signatures of multisig inputs, 4 locking scripts and unlocking data, 5
+	//the coinbase flag of snapshot entries
+	EncodingVersion = 5
+)
+
+var (
+	ErrBadEncoding = errors.New("data is not a valid encoding")
+)
+
+func (e *encoder) writeInt(n int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	e.buffer.Write(buf[:])
+}
+
+func (e *encoder) writeLen(n int) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(n))
+	e.buffer.Write(buf[:])
+}
+
+func (e *encoder) writeBytes(data []byte) {
+	e.writeLen(len(data))
+	e.buffer.Write(data)
+}
+
+func (e *encoder) writeBool(b bool) {
+	if b {
+		e.buffer.WriteByte(1)
+	} else {
+		e.buffer.WriteByte(0)
+	}
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeBytes([]byte(s))
+}
+
+func (e *encoder) writeInput(in *TxInput) {
+	e.writeBytes(in.ID)
+	e.writeString(in.SenderAddress)
+	e.writeInt(int64(in.Out))
+	e.writeBytes(in.Signature)
+	e.writeBytes(in.PubKey)
+	if e.version >= 3 {
+		e.writeLen(len(in.Signatures))
+		for _, signature := range in.Signatures {
+			e.writeBytes(signature)
+		}
+	}
+	if e.version >= 4 {
+		e.writeBytes(in.Unlock)
+	}
+}
+
+func (e *encoder) writeOutput(out *TxOutput) {
+	e.writeInt(int64(out.Value))
+	e.writeString(out.Address)
+	e.writeBytes(out.PubKeyHash)
+	if e.version >= 2 {
+		e.writeInt(int64(out.LockBlocks))
+	}
+	if e.version >= 4 {
+		e.writeBytes(out.Script)
+	}
+}
+
+func (e *encoder) writeTransaction(tx *Transaction) {
+	e.writeBytes(tx.ID)
+	e.writeLen(len(tx.Inputs))
+	for i := range tx.Inputs {
+		e.writeInput(&tx.Inputs[i])
+	}
+	e.writeLen(len(tx.Outputs))
+	for i := range tx.Outputs {
+		e.writeOutput(&tx.Outputs[i])
+	}
+	if e.version >= 2 {
+		e.writeInt(tx.LockTime)
+	}
+}
+
+func (e *encoder) writeHeader(h *BlockHeader) {
+	e.writeInt(int64(h.Version))
+	e.writeBytes(h.PrevHash)
+	e.writeBytes(h.MerkleRoot)
+	e.writeInt(int64(h.Height))
+	e.writeInt(h.Timestamp)
+	e.writeString(h.Validator)
+	e.writeString(h.ChainID)
+}
+
+func (e *encoder) writeBlock(b *Block) {
+	e.writeHeader(&b.BlockHeader)
+	e.writeBytes(b.Hash)
+	e.writeLen(len(b.Transaction))
+	for _, tx := range b.Transaction {
+		e.writeTransaction(tx)
+	}
+}
+
+//serialize prefixes what write encodes with the magic byte and version
+func serialize(write func(e *encoder)) []byte {
+	e := &encoder{version: EncodingVersion}
+	e.buffer.Write([]byte{encodingMagic, EncodingVersion})
+	write(e)
+	return e.buffer.Bytes()
+}
+
+//hashData is what write encodes, without prefix, for hashing
+func hashData(write func(e *encoder)) []byte {
+	e := &encoder{version: EncodingVersion}
+	write(e)
+	return e.buffer.Bytes()
+}
+
+//isCanonical tells data written by serialize apart from legacy gob data
+func isCanonical(data []byte) bool {
+	return len(data) > 0 && data[0] == encodingMagic
+}
+
+//newDecoder checks the prefix written by serialize
+func newDecoder(data []byte) (*decoder, error) {
+	if len(data) < 2 || data[0] != encodingMagic {
+		return nil, ErrBadEncoding
+	}
+	if data[1] == 0 || data[1] > EncodingVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrBadEncoding, data[1])
+	}
+
+	return &decoder{reader: bytes.NewReader(data[2:]), version: data[1]}, nil
+}
+
+//finish returns the first error, or an error when data is left over
+func (d *decoder) finish() error {
+	if d.err == nil && d.reader.Len() > 0 {
+		d.err = fmt.Errorf("%w: %d trailing bytes", ErrBadEncoding, d.reader.Len())
+	}
+	return d.err
+}
+
+func (d *decoder) read(buf []byte) {
+	if d.err != nil {
+		return
+	}
+	if _, err := io.ReadFull(d.reader, buf); err != nil {
+		d.err = fmt.Errorf("%w: %s", ErrBadEncoding, err)
+	}
+}
+
+func (d *decoder) readInt() int64 {
+	var buf [8]byte
+	d.read(buf[:])
+	return int64(binary.BigEndian.Uint64(buf[:]))
+}
+
+func (d *decoder) readLen() int {
+	var buf [4]byte
+	d.read(buf[:])
+	n := int(binary.BigEndian.Uint32(buf[:]))
+
+	//every item takes at least one byte, so a longer list cannot be valid
+	if d.err == nil && n > d.reader.Len() {
+		d.err = fmt.Errorf("%w: length %d is past the end", ErrBadEncoding, n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) readBytes() []byte {
+	n := d.readLen()
+	if n == 0 || d.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	d.read(buf)
+	return buf
+}
+
+func (d *decoder) readBool() bool {
+	var buf [1]byte
+	d.read(buf[:])
+	if d.err == nil && buf[0] > 1 {
+		d.err = fmt.Errorf("%w: bool %d", ErrBadEncoding, buf[0])
+	}
+	return buf[0] == 1
+}
+
+func (d *decoder) readString() string {
+	return string(d.readBytes())
+}
+
+func (d *decoder) readInput() TxInput {
+	var in TxInput
+	in.ID = d.readBytes()
+	in.SenderAddress = d.readString()
+	in.Out = int(d.readInt())
+	in.Signature = d.readBytes()
+	in.PubKey = d.readBytes()
+	if d.version >= 3 {
+		for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+			in.Signatures = append(in.Signatures, d.readBytes())
+		}
+	}
+	if d.version >= 4 {
+		in.Unlock = d.readBytes()
+	}
+	return in
+}
+
+func (d *decoder) readOutput() TxOutput {
+	var out TxOutput
+	out.Value = int(d.readInt())
+	out.Address = d.readString()
+	out.PubKeyHash = d.readBytes()
+	if d.version >= 2 {
+		out.LockBlocks = int(d.readInt())
+	}
+	if d.version >= 4 {
+		out.Script = d.readBytes()
+	}
+	return out
+}
+
+func (d *decoder) readTransaction() Transaction {
+	var tx Transaction
+	tx.ID = d.readBytes()
+	for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+		tx.Inputs = append(tx.Inputs, d.readInput())
+	}
+	for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+		tx.Outputs = append(tx.Outputs, d.readOutput())
+	}
+	if d.version >= 2 {
+		tx.LockTime = d.readInt()
+	}
+	return tx
+}
+
+func (d *decoder) readHeader() BlockHeader {
+	var h BlockHeader
+	h.Version = int(d.readInt())
+	h.PrevHash = d.readBytes()
+	h.MerkleRoot = d.readBytes()
+	h.Height = int(d.readInt())
+	h.Timestamp = d.readInt()
+	h.Validator = d.readString()
+	h.ChainID = d.readString()
+	return h
+}
+
+func (d *decoder) readBlock() Block {
+	var b Block
+	b.BlockHeader = d.readHeader()
+	b.Hash = d.readBytes()
+	for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+		tx := d.readTransaction()
+		b.Transaction = append(b.Transaction, &tx)
+	}
+	return b
+}
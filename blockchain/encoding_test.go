@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+//encodingTestBlock holds a transaction for the fields of every encoding
+//version, with every byte field set
+func encodingTestBlock() *Block {
+	plain := &Transaction{[]byte("plain"), []TxInput{{[]byte("prev"), "sender", 1, []byte("sig"), []byte("key"), nil, nil}},
+		[]TxOutput{{5, "address", []byte("hash"), 0, nil}}, 0}
+	locked := &Transaction{[]byte("locked"), []TxInput{{[]byte("prev"), "sender", 0, []byte("sig"), []byte("key"), nil, nil}},
+		[]TxOutput{{5, "address", []byte("hash"), 3, nil}}, 1700000000}
+	multisig := &Transaction{[]byte("multisig"), []TxInput{{[]byte("prev"), "sender", 2, nil, []byte("script"), [][]byte{[]byte("a"), []byte("b")}, nil}},
+		[]TxOutput{{-1, "", nil, 0, nil}}, 0}
+	script := &Transaction{[]byte("script"), []TxInput{{[]byte("prev"), "", 0, nil, nil, nil, []byte("unlock")}},
+		[]TxOutput{{7, "address", []byte("hash"), 0, []byte("lock")}}, 0}
+
+	header := BlockHeader{BlockVersion, []byte("parent"), []byte("root"), 9, 1700000001, "validator", DefaultChainID}
+	return &Block{header, []byte("hash"), []*Transaction{plain, locked, multisig, script}}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	block := encodingTestBlock()
+
+	data := block.Serialize()
+	decoded, err := Deserialize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, block) {
+		t.Fatalf("block does not round-trip:\n%+v\n%+v", decoded, block)
+	}
+	if !bytes.Equal(decoded.Serialize(), data) {
+		t.Fatal("block is encoded differently after a round-trip")
+	}
+
+	header, err := DeserializeHeader(block.BlockHeader.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*header, block.BlockHeader) {
+		t.Fatalf("header does not round-trip: %+v", header)
+	}
+
+	for _, tx := range block.Transaction {
+		decoded, err := DeserializeTransaction(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&decoded, tx) {
+			t.Fatalf("transaction %s does not round-trip: %+v", tx.ID, decoded)
+		}
+	}
+}
+
+//the hashes are fixed: another encoding of the same objects would change the
+//IDs of stored transactions and the hashes of stored blocks
+func TestEncodingHashes(t *testing.T) {
+	block := encodingTestBlock()
+
+	for i, want := range []string{
+		"a8156fb5cef013d1590bee4bf7d42bc360716ad2ea673e404fe4409d057423f0",
+		"369fecdf11a4b62846b762275bd9e70f380725755cffb58994f92cc71d9936c3",
+		"c97704e9af9cee1fa7300b9eef31295a185a111cd3c495384c107d5b2581c3d6",
+		"12e20b9caa38417a0e04bc3959fd1edb1199f8fbc40b33f0ce09c07802eb1671",
+	} {
+		if got := hex.EncodeToString(block.Transaction[i].Hash()); got != want {
+			t.Errorf("hash of transaction %s is %s, want %s", block.Transaction[i].ID, got, want)
+		}
+	}
+
+	if got, want := hex.EncodeToString(block.BlockHashing()), "51da8c594c5d4d53d0a8cff0953c57acfdd68e0242c831bd46ec35a6ab63cf96"; got != want {
+		t.Errorf("block hash is %s, want %s", got, want)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	data := encodingTestBlock().Serialize()
+
+	for n := 0; n < len(data); n++ {
+		if _, err := Deserialize(data[:n]); err == nil {
+			t.Fatalf("block cut after %d of %d bytes decodes", n, len(data))
+		}
+	}
+	if _, err := Deserialize(append(data, 0)); err == nil {
+		t.Fatal("block with a trailing byte decodes")
+	}
+
+	version := append([]byte{}, data...)
+	version[1] = EncodingVersion + 1
+	if _, err := Deserialize(version); err == nil {
+		t.Fatal("block of an unknown encoding version decodes")
+	}
+}
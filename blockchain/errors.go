@@ -0,0 +1,17 @@
+package blockchain
+
+import (
+	"errors"
+)
+
+//Errors returned by the blockchain API. Consensus rule violations are
+//returned as RuleError, see validation.go
+var (
+	ErrBlockchainExists = errors.New("Blockchain already exists")
+	ErrNoBlockchain     = errors.New("no existing blockchain found")
+	ErrBlockNotFound    = errors.New("Block is not found")
+	ErrTxNotFound       = errors.New("Transaction does not exist")
+	ErrNotEnoughFunds   = errors.New("Not enough funds")
+	ErrNoHistory        = errors.New("blocks below the base of the chain are pruned or were never stored")
+	ErrBadStake         = errors.New("stake transaction does not pay the coins of its signer back to it")
+)
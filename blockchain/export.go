@@ -0,0 +1,211 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//A chain export is exportMagic, the export version and then every block as a
+//4 byte big endian length followed by the block in the canonical encoding,
+//oldest first, until the end of the stream
+
+type (
+	//ExportWriter writes a chain export
+	ExportWriter struct {
+		w io.Writer
+	}
+
+	//ExportReader reads a chain export
+	ExportReader struct {
+		r io.Reader
+	}
+)
+
+const (
+	ExportVersion = 1
+	//maxExportBlock is the largest block an export may hold
+	maxExportBlock = 32 << 20
+)
+
+var (
+	exportMagic = []byte("TBCX")
+
+	ErrBadExport = errors.New("file is not a chain export")
+	ErrNoGenesis = errors.New("export does not start with a genesis block")
+)
+
+func NewExportWriter(w io.Writer) (*ExportWriter, error) {
+	if _, err := w.Write(append(append([]byte{}, exportMagic...), ExportVersion)); err != nil {
+		return nil, err
+	}
+
+	return &ExportWriter{w}, nil
+}
+
+func (e *ExportWriter) WriteBlock(block *Block) error {
+	data := block.Serialize()
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+
+	_, err := e.w.Write(data)
+	return err
+}
+
+func NewExportReader(r io.Reader) (*ExportReader, error) {
+	header := make([]byte, len(exportMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrBadExport
+	}
+
+	if !bytes.Equal(header[:len(exportMagic)], exportMagic) {
+		return nil, ErrBadExport
+	}
+	if header[len(exportMagic)] != ExportVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrBadExport, header[len(exportMagic)])
+	}
+
+	return &ExportReader{r}, nil
+}
+
+//ReadBlock returns the next block, or io.EOF after the last one
+func (e *ExportReader) ReadBlock() (*Block, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(e.r, length[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadExport, err)
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxExportBlock {
+		return nil, fmt.Errorf("%w: block of %d bytes", ErrBadExport, size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(e.r, data); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadExport, err)
+	}
+
+	return Deserialize(data)
+}
+
+//Export writes the main chain blocks from height start to end, or to the tip
+//when end is negative. progress is called after every block
+func (chain *Blockchain) Export(w io.Writer, start, end int, progress func(height int)) (int, error) {
+	writer, err := NewExportWriter(w)
+	if err != nil {
+		return 0, err
+	}
+
+	if end < 0 {
+		if end, err = chain.GetLastHeight(); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for height := start; height <= end; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return count, err
+		}
+
+		if err := writer.WriteBlock(&block); err != nil {
+			return count, err
+		}
+		count++
+		progress(height)
+	}
+
+	return count, nil
+}
+
+//Import adds the blocks of an export, validating each like a block received
+//from a peer. Blocks the chain already has are skipped. Blocks of
+//LegacyBlockVersion, which peers never send, are taken from an export with
+//the checks left for them, see checkLegacyBlock
+func (chain *Blockchain) Import(reader *ExportReader, progress func(height int)) (int, error) {
+	count := 0
+
+	for {
+		block, err := reader.ReadBlock()
+		if err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+
+		if block.Height == 0 && len(block.PrevHash) == 0 {
+			if _, err := chain.GetBlock(block.Hash); err != nil {
+				return count, fmt.Errorf("%w: %x", ErrBadGenesis, block.Hash)
+			}
+		} else if _, err := chain.processBlock(block, true); err != nil {
+			return count, fmt.Errorf("block %x at height %d: %w", block.Hash, block.Height, err)
+		}
+
+		count++
+		progress(block.Height)
+	}
+}
+
+//ImportBlockchain creates the chain of nodeID from an export that starts at
+//the genesis block and imports the rest of it. When config is given the
+//export has to start with its genesis block
+func ImportBlockchain(nodeID string, reader *ExportReader, config *GenesisConfig, progress func(height int)) (*Blockchain, int, error) {
+	var (
+		count     int
+		importErr error
+	)
+
+	//the chain is kept open when the import fails after the genesis block
+	chain, err := initBlockchain(nodeID, func(store ChainStore) (*Blockchain, error) {
+		var chain *Blockchain
+		chain, count, importErr = CreateBlockchainFromExport(store, reader, config, progress)
+		if chain == nil {
+			return nil, importErr
+		}
+		return chain, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return chain, count, importErr
+}
+
+//CreateBlockchainFromExport is ImportBlockchain into an empty store. An
+//export that starts with a genesis block of LegacyBlockVersion can only be
+//imported without config
+func CreateBlockchainFromExport(store ChainStore, reader *ExportReader, config *GenesisConfig, progress func(height int)) (*Blockchain, int, error) {
+	genesis, err := reader.ReadBlock()
+	if err == io.EOF {
+		return nil, 0, ErrNoGenesis
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	if genesis.Height != 0 || len(genesis.PrevHash) != 0 {
+		return nil, 0, ErrNoGenesis
+	}
+
+	var chain *Blockchain
+	if genesis.Version == LegacyBlockVersion && config == nil {
+		chain, err = createLegacyBlockchain(store, genesis)
+	} else {
+		chain, err = CreateBlockchainFromGenesis(store, genesis, config)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	progress(0)
+
+	count, err := chain.Import(reader, progress)
+	return chain, count + 1, err
+}
@@ -0,0 +1,140 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func exportChain(t *testing.T, chain *Blockchain) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if _, err := chain.Export(&buffer, 0, -1, func(int) {}); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+//importChain creates a chain in memory from an export of a chain made from
+//config
+func importChain(data []byte, config *GenesisConfig) (*Blockchain, int, error) {
+	reader, err := NewExportReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	genesis, err := reader.ReadBlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	chain, err := CreateBlockchainFromGenesis(NewMemoryStore(), genesis, config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count, err := chain.Import(reader, func(int) {})
+	return chain, count + 1, err
+}
+
+func TestExportImport(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := addTestBlock(t, chain, tipBlock(t, chain), forger, 1, toB)
+	addTestBlock(t, chain, m1, forger, 0)
+	data := exportChain(t, chain)
+
+	imported, count, err := importChain(data, chain.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || !bytes.Equal(imported.LastHash, chain.LastHash) {
+		t.Fatalf("imported %d blocks up to %x, want 3 up to %x", count, imported.LastHash, chain.LastHash)
+	}
+	if !reflect.DeepEqual(utxoIndex(t, imported), utxoIndex(t, chain)) {
+		t.Fatal("imported UTXO set differs")
+	}
+	if !bytes.Equal(exportChain(t, imported), data) {
+		t.Fatal("export of the imported chain differs")
+	}
+
+	//importing blocks the chain already has changes nothing
+	reader, err := NewExportReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := imported.Import(reader, func(int) {}); err != nil || count != 3 {
+		t.Fatalf("reimported %d blocks (%v), want 3", count, err)
+	}
+	if !bytes.Equal(imported.LastHash, chain.LastHash) {
+		t.Fatal("reimport moved the tip")
+	}
+
+	//another chain does not take the export
+	other, _ := newTestChain(t)
+	reader, err = NewExportReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Import(reader, func(int) {}); !errors.Is(err, ErrBadGenesis) {
+		t.Fatalf("export of another chain: got %v, want %v", err, ErrBadGenesis)
+	}
+}
+
+func TestImportCorrupt(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger := newTestWallet(t)
+	addTestBlock(t, chain, tipBlock(t, chain), forger, 0)
+	data := exportChain(t, chain)
+
+	badMagic := append([]byte("XXXX"), data[len(exportMagic):]...)
+	badVersion := append([]byte{}, data...)
+	badVersion[len(exportMagic)]++
+	tooLarge := append(append([]byte{}, data[:len(exportMagic)+1]...), 0xff, 0xff, 0xff, 0xff)
+
+	for name, corrupt := range map[string][]byte{
+		"empty":       nil,
+		"magic":       badMagic,
+		"version":     badVersion,
+		"truncated":   data[:len(data)-1],
+		"large block": tooLarge,
+	} {
+		if _, _, err := importChain(corrupt, chain.Config); !errors.Is(err, ErrBadExport) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrBadExport)
+		}
+	}
+
+	//a block whose coinbase was changed after it was made
+	reader, err := NewExportReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	writer, err := NewExportWriter(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		block, err := reader.ReadBlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if block.Height == 1 {
+			block.Transaction[0].Outputs[0].Value++
+		}
+		if err := writer.WriteBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := importChain(buffer.Bytes(), chain.Config); err == nil {
+		t.Fatal("tampered block imported")
+	}
+}
@@ -0,0 +1,276 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/test-blockchain/wallet"
+)
+
+type (
+	//GenesisConfig describes the genesis block of a chain and the rules its
+	//nodes agree on. Nodes made from the same file have the same genesis hash
+	GenesisConfig struct {
+		ChainID     string              `json:"chain_id"`
+		Timestamp   int64               `json:"timestamp"`
+		Allocations []GenesisAllocation `json:"allocations"`
+		Validators  []GenesisValidator  `json:"validators"`
+		Params      ConsensusParams     `json:"params"`
+	}
+
+	//GenesisAllocation is an amount paid to an address by the genesis block
+	GenesisAllocation struct {
+		Address string `json:"address"`
+		Amount  int    `json:"amount"`
+	}
+
+	//GenesisValidator can forge blocks without sending a stake transaction
+	//first, Stake is its weight in the lottery
+	GenesisValidator struct {
+		Address string `json:"address"`
+		Stake   int    `json:"stake"`
+	}
+
+	ConsensusParams struct {
+		//BlockReward is the value the coinbase of a forged block mints
+		BlockReward int `json:"block_reward"`
+		//ForgeInterval is how many seconds the forger waits between blocks
+		ForgeInterval uint64 `json:"forge_interval"`
+		//HalvingInterval is how many blocks pass before BlockReward halves, 0
+		//never halves it
+		HalvingInterval int `json:"halving_interval"`
+		//MaxSupply caps the coins of the genesis block and every block reward
+		//together, 0 does not cap them
+		MaxSupply int `json:"max_supply"`
+		//CoinbaseMaturity is how many blocks later the outputs of a coinbase
+		//can be spent. The genesis block is spendable right away
+		CoinbaseMaturity int `json:"coinbase_maturity"`
+	}
+)
+
+const (
+	//defaultGenesisTime is the timestamp of a genesis block made without a
+	//genesis file, 2020-01-01 UTC
+	defaultGenesisTime = 1577836800
+	//defaultAllocation is what a genesis block made without a genesis file pays
+	defaultAllocation       = 50
+	defaultForgeInterval    = 5
+	defaultCoinbaseMaturity = 10
+)
+
+var (
+	//genesis holds the GenesisConfig of the chain as JSON
+	genesisKey = []byte("genesis")
+
+	ErrBadGenesisConfig = errors.New("genesis file is not valid")
+	ErrNoGenesisConfig  = errors.New("genesis file of the chain is needed")
+)
+
+//DefaultParams are the consensus parameters of chains made before genesis
+//files, and the ones a genesis file leaves out
+func DefaultParams() ConsensusParams {
+	return ConsensusParams{BlockReward, defaultForgeInterval, 0, 0, defaultCoinbaseMaturity}
+}
+
+//DefaultGenesisConfig is the genesis of createblockchain -address: the
+//default chain ID and parameters, paying address at a fixed time
+func DefaultGenesisConfig(address string) *GenesisConfig {
+	return &GenesisConfig{
+		ChainID:     DefaultChainID,
+		Timestamp:   defaultGenesisTime,
+		Allocations: []GenesisAllocation{{address, defaultAllocation}},
+		Params:      DefaultParams(),
+	}
+}
+
+//LoadGenesisConfig reads and checks a genesis file
+func LoadGenesisConfig(path string) (*GenesisConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseGenesisConfig(data)
+}
+
+//ParseGenesisConfig reads a genesis file. The params it leaves out are the
+//DefaultParams, the ones it sets are kept even when they are 0
+func ParseGenesisConfig(data []byte) (*GenesisConfig, error) {
+	config := GenesisConfig{Params: DefaultParams()}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadGenesisConfig, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func (config *GenesisConfig) Validate() error {
+	if config.ChainID == "" {
+		return fmt.Errorf("%w: chain_id is empty", ErrBadGenesisConfig)
+	}
+
+	if config.Timestamp <= 0 {
+		return fmt.Errorf("%w: timestamp is not set", ErrBadGenesisConfig)
+	}
+
+	if len(config.Allocations) == 0 {
+		return fmt.Errorf("%w: no allocations", ErrBadGenesisConfig)
+	}
+	for _, alloc := range config.Allocations {
+		if !wallet.ValidateAddress(alloc.Address) {
+			return fmt.Errorf("%w: allocation to %q: %s", ErrBadGenesisConfig, alloc.Address, wallet.ErrInvalidAddress)
+		}
+		if alloc.Amount <= 0 {
+			return fmt.Errorf("%w: allocation of %d to %s", ErrBadGenesisConfig, alloc.Amount, alloc.Address)
+		}
+	}
+
+	for _, v := range config.Validators {
+		if !wallet.ValidateAddress(v.Address) {
+			return fmt.Errorf("%w: validator %q: %s", ErrBadGenesisConfig, v.Address, wallet.ErrInvalidAddress)
+		}
+		if v.Stake <= 0 {
+			return fmt.Errorf("%w: stake of %d for %s", ErrBadGenesisConfig, v.Stake, v.Address)
+		}
+	}
+
+	if config.Params.BlockReward < 0 {
+		return fmt.Errorf("%w: block_reward is negative", ErrBadGenesisConfig)
+	}
+	if config.Params.ForgeInterval == 0 {
+		return fmt.Errorf("%w: forge_interval is not set", ErrBadGenesisConfig)
+	}
+	if config.Params.HalvingInterval < 0 {
+		return fmt.Errorf("%w: halving_interval is negative", ErrBadGenesisConfig)
+	}
+	if config.Params.CoinbaseMaturity < 0 {
+		return fmt.Errorf("%w: coinbase_maturity is negative", ErrBadGenesisConfig)
+	}
+	if config.Params.MaxSupply < 0 {
+		return fmt.Errorf("%w: max_supply is negative", ErrBadGenesisConfig)
+	}
+	if config.Params.MaxSupply > 0 && config.GenesisSupply() > config.Params.MaxSupply {
+		return fmt.Errorf("%w: allocations are above max_supply", ErrBadGenesisConfig)
+	}
+
+	return nil
+}
+
+//Block builds the genesis block. It has a single coinbase paying every
+//allocation, its input data is the chain ID and the hash of the whole config,
+//so the genesis hash commits to the validators and params too
+func (config *GenesisConfig) Block() (*Block, error) {
+	hash, err := config.Hash()
+	if err != nil {
+		return nil, err
+	}
+	data := append([]byte("genesis of "+config.ChainID+" "), hash...)
+	txin := TxInput{[]byte{}, "", -1, nil, data, nil, nil}
+
+	var outputs []TxOutput
+	for _, alloc := range config.Allocations {
+		txout, err := NewTxOutput(alloc.Amount, alloc.Address)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *txout)
+	}
+
+	tx := Transaction{nil, []TxInput{txin}, outputs, 0}
+	tx.ID = tx.Hash()
+
+	header := BlockHeader{BlockVersion, []byte{}, nil, 0, config.Timestamp, "", config.ChainID}
+	block := &Block{header, nil, []*Transaction{&tx}}
+	block.MerkleRoot = block.HashTransactions()
+	block.Hash = block.BlockHashing()
+
+	return block, nil
+}
+
+func (config *GenesisConfig) Serialize() ([]byte, error) {
+	return json.Marshal(config)
+}
+
+//Hash is the sha256 of the serialized config
+func (config *GenesisConfig) Hash() ([]byte, error) {
+	data, err := config.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+//checkGenesis checks that genesis is the genesis block of config
+func (config *GenesisConfig) checkGenesis(genesis *Block) error {
+	expected, err := config.Block()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(genesis.Hash, expected.Hash) {
+		return ruleError(ErrBadGenesis, "got %x, genesis file has %x", genesis.Hash, expected.Hash)
+	}
+
+	return nil
+}
+
+func putGenesisConfig(txn StoreTxn, config *GenesisConfig) error {
+	data, err := config.Serialize()
+	if err != nil {
+		return err
+	}
+	return txn.Set(genesisKey, data)
+}
+
+//getGenesisConfig reads the config the chain was made from. Chains with a
+//genesis block of LegacyBlockVersion were made before genesis files, they get
+//the default parameters and the chain ID of their genesis block. Any other
+//chain without its config cannot be opened
+func getGenesisConfig(txn StoreTxn) (*GenesisConfig, error) {
+	data, err := txn.Get(genesisKey)
+	if err == nil {
+		return ParseGenesisConfig(data)
+	} else if err != ErrKeyNotFound {
+		return nil, err
+	}
+
+	hash, err := txn.Get(heightKey(0))
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := getHeader(txn, hash)
+	if err != nil {
+		return nil, err
+	}
+	if genesis.Version != LegacyBlockVersion {
+		return nil, ErrNoGenesisConfig
+	}
+
+	return &GenesisConfig{ChainID: genesis.ChainID, Timestamp: genesis.Timestamp, Params: DefaultParams()}, nil
+}
+
+//GenesisHash is the hash of the first block of the chain, peers with another
+//one are on another chain
+func (chain *Blockchain) GenesisHash() ([]byte, error) {
+	var hash []byte
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		var err error
+		hash, err = txn.Get(heightKey(0))
+		return err
+	})
+
+	return hash, err
+}
@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseGenesisConfigParams(t *testing.T) {
+	w := newTestWallet(t)
+	file := func(params string) []byte {
+		return []byte(fmt.Sprintf(`{"chain_id": "test", "timestamp": 1, "allocations": [{"address": %q, "amount": 10}]%s}`, w.Address(), params))
+	}
+
+	config, err := ParseGenesisConfig(file(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Params != DefaultParams() {
+		t.Fatalf("params left out are %+v, want %+v", config.Params, DefaultParams())
+	}
+
+	config, err = ParseGenesisConfig(file(`, "params": {"block_reward": 0, "coinbase_maturity": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Params.BlockReward != 0 || config.Params.CoinbaseMaturity != 0 {
+		t.Fatalf("explicit zeros became reward %d and maturity %d", config.Params.BlockReward, config.Params.CoinbaseMaturity)
+	}
+	if config.Params.ForgeInterval != defaultForgeInterval {
+		t.Fatalf("forge interval left out is %d, want %d", config.Params.ForgeInterval, defaultForgeInterval)
+	}
+
+	if _, err := ParseGenesisConfig(file(`, "params": {"forge_interval": 0}`)); !errors.Is(err, ErrBadGenesisConfig) {
+		t.Fatalf("forge interval 0: got %v, want %v", err, ErrBadGenesisConfig)
+	}
+}
+
+func TestGenesisCommitsToConfig(t *testing.T) {
+	w, v := newTestWallet(t), newTestWallet(t)
+	config := DefaultGenesisConfig(string(w.Address()))
+	genesis, err := config.Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := map[string]func(c *GenesisConfig){
+		"validators": func(c *GenesisConfig) { c.Validators = []GenesisValidator{{string(v.Address()), 10}} },
+		"reward":     func(c *GenesisConfig) { c.Params.BlockReward++ },
+		"maturity":   func(c *GenesisConfig) { c.Params.CoinbaseMaturity++ },
+		"supply":     func(c *GenesisConfig) { c.Params.MaxSupply = 1000 },
+	}
+	for name, change := range changes {
+		other := *DefaultGenesisConfig(string(w.Address()))
+		change(&other)
+		block, err := other.Block()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(block.Hash, genesis.Hash) {
+			t.Fatalf("changing %s kept the genesis hash", name)
+		}
+		if _, err := CreateBlockchainFromGenesis(NewMemoryStore(), genesis, &other); !errors.Is(err, ErrBadGenesis) {
+			t.Fatalf("genesis with another %s: got %v, want %v", name, err, ErrBadGenesis)
+		}
+	}
+
+	if _, err := CreateBlockchainFromGenesis(NewMemoryStore(), genesis, nil); !errors.Is(err, ErrNoGenesisConfig) {
+		t.Fatalf("genesis without its file: got %v, want %v", err, ErrNoGenesisConfig)
+	}
+
+	chain, err := CreateBlockchainFromGenesis(NewMemoryStore(), genesis, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Database.Update(func(txn StoreTxn) error {
+		return txn.Delete(genesisKey)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBlockchain(chain.Database); !errors.Is(err, ErrNoGenesisConfig) {
+		t.Fatalf("chain without its genesis file: got %v, want %v", err, ErrNoGenesisConfig)
+	}
+}
@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+)
+
+type (
+	//BlockHeader is everything the hash of a block commits to. The
+	//transactions are covered through MerkleRoot so headers can be stored and
+	//sent without the block bodies
+	BlockHeader struct {
+		Version    int
+		PrevHash   []byte
+		MerkleRoot []byte
+		Height     int
+		Timestamp  int64
+		Validator  string
+		ChainID    string
+	}
+)
+
+const (
+	BlockVersion = 1
+	//LegacyBlockVersion marks the blocks migrated from the gob encoding. Their
+	//hash and transaction IDs were computed from gob and their signatures with
+	//an older scheme, none of it can be checked again
+	LegacyBlockVersion = 0
+	//DefaultChainID is the chain ID given to blocks created by this node
+	DefaultChainID = "test-blockchain"
+)
+
+var (
+	//hdr-<hash> holds the header of every stored block
+	headerPrefix = []byte("hdr-")
+)
+
+func headerKey(hash []byte) []byte {
+	return append(append([]byte{}, headerPrefix...), hash...)
+}
+
+//Hash is the hash of the block with this header
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(hashData(func(e *encoder) { e.writeHeader(h) }))
+	return hash[:]
+}
+
+func (h *BlockHeader) Serialize() []byte {
+	return serialize(func(e *encoder) { e.writeHeader(h) })
+}
+
+func DeserializeHeader(data []byte) (*BlockHeader, error) {
+	var header BlockHeader
+
+	if !isCanonical(data) {
+		decode := gob.NewDecoder(bytes.NewReader(data))
+		if err := decode.Decode(&header); err != nil {
+			return nil, err
+		}
+		return &header, nil
+	}
+
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+
+	header = d.readHeader()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
+func getHeader(txn StoreTxn, hash []byte) (*BlockHeader, error) {
+	data, err := txn.Get(headerKey(hash))
+	if err == ErrKeyNotFound {
+		//blocks stored before headers were kept on their own
+		block, err := getBlock(txn, hash)
+		if err != nil {
+			return nil, err
+		}
+		return &block.BlockHeader, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return DeserializeHeader(data)
+}
+
+func putHeader(txn StoreTxn, hash []byte, header *BlockHeader) error {
+	return txn.Set(headerKey(hash), header.Serialize())
+}
+
+//GetHeader returns the header of a stored block or of a header added with
+//AddHeader
+func (chain *Blockchain) GetHeader(hash []byte) (BlockHeader, error) {
+	var header BlockHeader
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		h, err := getHeader(txn, hash)
+		if err == ErrKeyNotFound {
+			return ErrBlockNotFound
+		} else if err != nil {
+			return err
+		}
+		header = *h
+
+		return nil
+	})
+
+	return header, err
+}
+
+//GetHeaders returns up to max headers of the main chain starting at height
+func (chain *Blockchain) GetHeaders(height, max int) ([]BlockHeader, error) {
+	var headers []BlockHeader
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		for h := height; len(headers) < max; h++ {
+			hash, err := txn.Get(heightKey(h))
+			if err == ErrKeyNotFound {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			header, err := getHeader(txn, hash)
+			if err != nil {
+				return err
+			}
+			headers = append(headers, *header)
+		}
+
+		return nil
+	})
+
+	return headers, err
+}
+
+//AddHeader stores a header received without its block after checking it
+//extends a known header
+func (chain *Blockchain) AddHeader(header *BlockHeader) error {
+	return chain.Database.Update(func(txn StoreTxn) error {
+		hash := header.Hash()
+		if hasKey(txn, headerKey(hash)) {
+			return nil
+		}
+
+		parent, err := getHeader(txn, header.PrevHash)
+		if err == ErrKeyNotFound {
+			return ruleError(ErrUnknownParent, "%x", header.PrevHash)
+		} else if err != nil {
+			return err
+		}
+
+		if err := checkHeader(header, parent); err != nil {
+			return err
+		}
+
+		return putHeader(txn, header.Hash(), header)
+	})
+}
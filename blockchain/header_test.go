@@ -0,0 +1,29 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHeaderHashCommitsToFields(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger := newTestWallet(t)
+	block := newTestBlock(t, tipBlock(t, chain), forger, chain.Config.BlockSubsidy(1))
+
+	changes := map[string]func(h *BlockHeader){
+		"height":    func(h *BlockHeader) { h.Height++ },
+		"timestamp": func(h *BlockHeader) { h.Timestamp++ },
+		"validator": func(h *BlockHeader) { h.Validator = string(forger.Address()) },
+	}
+	for name, change := range changes {
+		header := block.BlockHeader
+		change(&header)
+		if bytes.Equal(header.Hash(), block.Hash) {
+			t.Errorf("changing the %s keeps the header hash", name)
+		}
+	}
+
+	if !bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+		t.Fatal("header hash is not the block hash")
+	}
+}
@@ -0,0 +1,337 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+type (
+	//HeaderChain is what a light node keeps: the headers of the chain and the
+	//transactions of its addresses, each proven by a merkle proof
+	HeaderChain struct {
+		Database ChainStore
+		//Genesis is the hash of the genesis header the chain starts from, a
+		//chain without one takes no genesis header
+		Genesis []byte
+	}
+
+	//ProvenTx is a transaction a light node has checked to be in a block
+	ProvenTx struct {
+		Transaction Transaction
+		BlockHash   []byte
+		Height      int
+		Timestamp   int64
+	}
+)
+
+var (
+	headerDBPath = "./tmp/headers_%s"
+
+	//ptx-<txid> holds a ProvenTx
+	provenTxPrefix = []byte("ptx-")
+)
+
+func provenTxKey(txID []byte) []byte {
+	return append(append([]byte{}, provenTxPrefix...), txID...)
+}
+
+func (p ProvenTx) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(p)
+	return buffer.Bytes(), err
+}
+
+func DeserializeProvenTx(data []byte) (ProvenTx, error) {
+	var p ProvenTx
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&p)
+	return p, err
+}
+
+//OpenHeaderChain opens the header store of a light node, creating it if
+//needed. Only the genesis header with hash genesis is taken, nil keeps the
+//one the store already has
+func OpenHeaderChain(nodeID string, genesis []byte) (*HeaderChain, error) {
+	store, err := NewBadgerStore(fmt.Sprintf(headerDBPath, nodeID))
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := NewHeaderChain(store, genesis)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return hc, nil
+}
+
+//NewHeaderChain keeps headers in store, starting from the genesis header with
+//hash genesis. It fails when store already starts from another one
+func NewHeaderChain(store ChainStore, genesis []byte) (*HeaderChain, error) {
+	var stored []byte
+
+	err := store.View(func(txn StoreTxn) error {
+		var err error
+		stored, err = txn.Get(heightKey(0))
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if genesis == nil {
+		genesis = stored
+	} else if stored != nil && !bytes.Equal(stored, genesis) {
+		return nil, fmt.Errorf("%w: headers start from %x, not %x", ErrBadGenesis, stored, genesis)
+	}
+
+	return &HeaderChain{store, genesis}, nil
+}
+
+//LoadHeaderChain opens the header store of a light node that has synced before
+func LoadHeaderChain(nodeID string) (*HeaderChain, error) {
+	path := fmt.Sprintf(headerDBPath, nodeID)
+	if DBexists(path) == false {
+		return nil, ErrNoBlockchain
+	}
+
+	return OpenHeaderChain(nodeID, nil)
+}
+
+//Height is the height of the highest header, or -1 before the genesis header
+//is known
+func (hc *HeaderChain) Height() (int, error) {
+	height := -1
+
+	err := hc.Database.View(func(txn StoreTxn) error {
+		tip, err := getTip(txn)
+		if err == ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		header, err := getHeader(txn, tip)
+		if err != nil {
+			return err
+		}
+		height = header.Height
+
+		return nil
+	})
+
+	return height, err
+}
+
+//AddHeader checks that header extends a known header, or is the genesis
+//header of hc, and stores it. Like for blocks the highest branch is the main
+//chain
+func (hc *HeaderChain) AddHeader(header *BlockHeader) error {
+	hash := header.Hash()
+
+	return hc.Database.Update(func(txn StoreTxn) error {
+		if hasKey(txn, headerKey(hash)) {
+			return nil
+		}
+
+		tip, err := getTip(txn)
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+
+		if tip == nil {
+			if header.Height != 0 || len(header.PrevHash) != 0 {
+				return ruleError(ErrUnknownParent, "%x", header.PrevHash)
+			}
+			if !bytes.Equal(hash, hc.Genesis) {
+				return ruleError(ErrBadGenesis, "%x is not %x", hash, hc.Genesis)
+			}
+		} else {
+			parent, err := getHeader(txn, header.PrevHash)
+			if err == ErrKeyNotFound {
+				return ruleError(ErrUnknownParent, "%x", header.PrevHash)
+			} else if err != nil {
+				return err
+			}
+
+			if err := checkHeader(header, parent); err != nil {
+				return err
+			}
+
+			tipHeader, err := getHeader(txn, tip)
+			if err != nil {
+				return err
+			}
+			if header.Height <= tipHeader.Height {
+				return putHeader(txn, hash, header)
+			}
+		}
+
+		if err := putHeader(txn, hash, header); err != nil {
+			return err
+		}
+
+		//point the height index at the new branch down to where it joins the
+		//old one
+		for cur, curHash := header, hash; ; {
+			old, err := txn.Get(heightKey(cur.Height))
+			if err == nil && bytes.Equal(old, curHash) {
+				break
+			} else if err != nil && err != ErrKeyNotFound {
+				return err
+			}
+
+			if err := txn.Set(heightKey(cur.Height), curHash); err != nil {
+				return err
+			}
+			if len(cur.PrevHash) == 0 {
+				break
+			}
+
+			curHash = cur.PrevHash
+			if cur, err = getHeader(txn, curHash); err != nil {
+				return err
+			}
+		}
+
+		return setTip(txn, hash)
+	})
+}
+
+//onMainChain reports whether hash is the header at height on the main chain
+func onMainChain(txn StoreTxn, hash []byte, height int) bool {
+	mainHash, err := txn.Get(heightKey(height))
+	return err == nil && bytes.Equal(mainHash, hash)
+}
+
+//AddProvenTx stores a transaction once proof shows it is in a block of the
+//main chain
+func (hc *HeaderChain) AddProvenTx(tx Transaction, proof TxProof) error {
+	if !bytes.Equal(tx.ID, tx.Hash()) || !bytes.Equal(tx.ID, proof.TxID) {
+		return ruleError(ErrBadTxID, "%x", tx.ID)
+	}
+
+	if !proof.Verify() {
+		return ruleError(ErrBadMerkleRoot, "%x", tx.ID)
+	}
+
+	return hc.Database.Update(func(txn StoreTxn) error {
+		if !onMainChain(txn, proof.BlockHash, proof.Header.Height) {
+			return ErrBlockNotFound
+		}
+
+		data, err := ProvenTx{tx, proof.BlockHash, proof.Header.Height, proof.Header.Timestamp}.Serialize()
+		if err != nil {
+			return err
+		}
+		return txn.Set(provenTxKey(tx.ID), data)
+	})
+}
+
+//provenTxs returns the stored transactions that are still on the main chain
+func (hc *HeaderChain) provenTxs() (map[string]ProvenTx, error) {
+	txs := make(map[string]ProvenTx)
+
+	err := hc.Database.View(func(txn StoreTxn) error {
+		var err error
+
+		iterErr := txn.Iterate(provenTxPrefix, func(key, value []byte) bool {
+			var p ProvenTx
+			if p, err = DeserializeProvenTx(value); err != nil {
+				return false
+			}
+			if onMainChain(txn, p.BlockHash, p.Height) {
+				txs[hex.EncodeToString(p.Transaction.ID)] = p
+			}
+			return true
+		})
+		if iterErr != nil {
+			return iterErr
+		}
+
+		return err
+	})
+
+	return txs, err
+}
+
+//Balance sums the outputs locked to pubKeyHash that no proven transaction
+//spends
+func (hc *HeaderChain) Balance(pubKeyHash []byte) (int, error) {
+	txs, err := hc.provenTxs()
+	if err != nil {
+		return 0, err
+	}
+
+	spent := make(map[string]bool)
+	for _, p := range txs {
+		if p.Transaction.IsCoinbase() {
+			continue
+		}
+		for _, in := range p.Transaction.Inputs {
+			spent[fmt.Sprintf("%x:%d", in.ID, in.Out)] = true
+		}
+	}
+
+	balance := 0
+	for id, p := range txs {
+		for i, out := range p.Transaction.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) && !spent[fmt.Sprintf("%s:%d", id, i)] {
+				balance += out.Value
+			}
+		}
+	}
+
+	return balance, nil
+}
+
+//History returns the proven transactions of pubKeyHash, newest first
+func (hc *HeaderChain) History(pubKeyHash []byte) ([]AddressTx, error) {
+	var history []AddressTx
+
+	txs, err := hc.provenTxs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range txs {
+		tx := p.Transaction
+		amount, touched := 0, false
+
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				prev, ok := txs[hex.EncodeToString(in.ID)]
+				if !ok || in.Out < 0 || in.Out >= len(prev.Transaction.Outputs) {
+					continue
+				}
+				if out := prev.Transaction.Outputs[in.Out]; out.IsLockedWithKey(pubKeyHash) {
+					amount -= out.Value
+					touched = true
+				}
+			}
+		}
+		for _, out := range tx.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) {
+				amount += out.Value
+				touched = true
+			}
+		}
+		if touched {
+			history = append(history, AddressTx{tx.ID, p.BlockHash, p.Height, p.Timestamp, amount, tx.IsCoinbase()})
+		}
+	}
+
+	//newest first, like GetAddressHistory
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Height > history[j].Height
+	})
+
+	return history, nil
+}
@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestHeaderChainGenesis(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger := newTestWallet(t)
+	genesis := tipBlock(t, chain)
+	block := addTestBlock(t, chain, genesis, forger, 0)
+
+	other, _ := newTestChain(t)
+	otherGenesis := tipBlock(t, other)
+
+	headers, err := NewHeaderChain(NewMemoryStore(), genesis.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := headers.AddHeader(&otherGenesis.BlockHeader); !errors.Is(err, ErrBadGenesis) {
+		t.Fatalf("genesis of another chain: got %v, want %v", err, ErrBadGenesis)
+	}
+	if err := headers.AddHeader(&block.BlockHeader); !errors.Is(err, ErrUnknownParent) {
+		t.Fatalf("header before its genesis: got %v, want %v", err, ErrUnknownParent)
+	}
+	for _, b := range []*Block{genesis, block} {
+		if err := headers.AddHeader(&b.BlockHeader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if height, err := headers.Height(); err != nil || height != 1 {
+		t.Fatalf("height %d, %v, want 1", height, err)
+	}
+
+	//the store keeps its genesis when opened again
+	reopened, err := NewHeaderChain(headers.Database, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reopened.Genesis, genesis.Hash) {
+		t.Fatalf("genesis %x, want %x", reopened.Genesis, genesis.Hash)
+	}
+	if _, err := NewHeaderChain(headers.Database, otherGenesis.Hash); !errors.Is(err, ErrBadGenesis) {
+		t.Fatalf("store of another chain: got %v, want %v", err, ErrBadGenesis)
+	}
+
+	unpinned, err := NewHeaderChain(NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unpinned.AddHeader(&genesis.BlockHeader); !errors.Is(err, ErrBadGenesis) {
+		t.Fatalf("genesis without a pinned hash: got %v, want %v", err, ErrBadGenesis)
+	}
+}
@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsFinal(t *testing.T) {
+	cases := []struct {
+		lockTime  int64
+		height    int
+		timestamp int64
+		want      bool
+	}{
+		{0, 0, 0, true},
+		{5, 4, LockTimeThreshold + 10, false},
+		{5, 5, 0, true},
+		{LockTimeThreshold + 10, 1000, LockTimeThreshold + 9, false},
+		{LockTimeThreshold + 10, 0, LockTimeThreshold + 10, true},
+	}
+	for _, c := range cases {
+		tx := Transaction{LockTime: c.lockTime}
+		if got := tx.IsFinal(c.height, c.timestamp); got != c.want {
+			t.Errorf("lock time %d at height %d, time %d: got %v, want %v", c.lockTime, c.height, c.timestamp, got, c.want)
+		}
+	}
+}
+
+func TestLockTime(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+	pool := NewMempool(chain, MaxPoolTxs, MaxPoolSize)
+	genesis := tipBlock(t, chain)
+
+	tx, err := NewLockedTransaction(a, string(a.Address()), string(b.Address()), 10, 1, 2, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("pool refused a locked transaction: %s", err)
+	}
+	if txs, _ := pool.Transactions(1, genesis.Timestamp); len(txs) != 0 {
+		t.Fatalf("%d transactions for the block at height 1, want none", len(txs))
+	}
+	if txs, _ := pool.Transactions(2, genesis.Timestamp); len(txs) != 1 {
+		t.Fatalf("%d transactions for the block at height 2, want 1", len(txs))
+	}
+
+	early := newTestBlock(t, genesis, forger, chain.Config.BlockSubsidy(1)+1, tx)
+	if err := chain.AddBlock(early); !errors.Is(err, ErrLockTime) {
+		t.Fatalf("block at height 1: got %v, want %v", err, ErrLockTime)
+	}
+	m1 := addTestBlock(t, chain, genesis, forger, 0)
+	addTestBlock(t, chain, m1, forger, 1, tx)
+
+	if got := balance(t, chain, b); got != 10 {
+		t.Fatalf("balance of b is %d, want 10", got)
+	}
+}
+
+func TestLockBlocks(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, c, forger := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	//confirmed at height 1, b can spend it from height 4
+	tx, err := NewLockedTransaction(a, string(a.Address()), string(b.Address()), 10, 1, 0, 3, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := addTestBlock(t, chain, tipBlock(t, chain), forger, 1, tx)
+
+	spend := spendOutput(t, b, tx, 0, c, 9, 1)
+	for parent.Height < 3 {
+		if err := chain.VerifyTransaction(spend); !errors.Is(err, ErrRelativeLock) {
+			t.Fatalf("spend after block %d: got %v, want %v", parent.Height, err, ErrRelativeLock)
+		}
+		block := newTestBlock(t, parent, forger, chain.Config.BlockSubsidy(parent.Height+1)+1, spend)
+		if err := chain.AddBlock(block); !errors.Is(err, ErrRelativeLock) {
+			t.Fatalf("block %d: got %v, want %v", block.Height, err, ErrRelativeLock)
+		}
+		parent = addTestBlock(t, chain, parent, forger, 0)
+	}
+
+	if err := chain.VerifyTransaction(spend); err != nil {
+		t.Fatal(err)
+	}
+	addTestBlock(t, chain, parent, forger, 1, spend)
+	if got := balance(t, chain, c); got != 9 {
+		t.Fatalf("balance of c is %d, want 9", got)
+	}
+}
@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	//MemoryStore is a ChainStore that only lives in memory, for tests and
+	//simulations that should not touch ./tmp
+	MemoryStore struct {
+		mutex sync.RWMutex
+		data  map[string][]byte
+	}
+
+	//memoryTxn buffers the writes of an Update until it returns
+	memoryTxn struct {
+		store    *MemoryStore
+		writable bool
+		pending  map[string][]byte
+		deleted  map[string]bool
+	}
+
+	memoryBatch struct {
+		store *MemoryStore
+	}
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) GetBlock(hash []byte) (*Block, error) {
+	return storeGetBlock(s, hash)
+}
+
+func (s *MemoryStore) PutBlock(block *Block) error {
+	return storePutBlock(s, block)
+}
+
+func (s *MemoryStore) GetTip() ([]byte, error) {
+	return storeGetTip(s)
+}
+
+func (s *MemoryStore) SetTip(hash []byte) error {
+	return storeSetTip(s, hash)
+}
+
+func (s *MemoryStore) View(fn func(txn StoreTxn) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return fn(&memoryTxn{store: s})
+}
+
+func (s *MemoryStore) Update(fn func(txn StoreTxn) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	txn := &memoryTxn{s, true, make(map[string][]byte), make(map[string]bool)}
+	if err := fn(txn); err != nil {
+		return err
+	}
+
+	for key := range txn.deleted {
+		delete(s.data, key)
+	}
+	for key, value := range txn.pending {
+		s.data[key] = value
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) NewBatch() Batch {
+	return &memoryBatch{s}
+}
+
+//CollectGarbage has nothing to do, deleted keys are dropped from the map
+func (s *MemoryStore) CollectGarbage() error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	k := string(key)
+
+	if t.writable {
+		if value, ok := t.pending[k]; ok {
+			return append([]byte{}, value...), nil
+		}
+		if t.deleted[k] {
+			return nil, ErrKeyNotFound
+		}
+	}
+
+	value, ok := t.store.data[k]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+func (t *memoryTxn) Set(key, value []byte) error {
+	if !t.writable {
+		return ErrReadOnlyTxn
+	}
+
+	k := string(key)
+	delete(t.deleted, k)
+	t.pending[k] = append([]byte{}, value...)
+
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	if !t.writable {
+		return ErrReadOnlyTxn
+	}
+
+	k := string(key)
+	delete(t.pending, k)
+	t.deleted[k] = true
+
+	return nil
+}
+
+//keys returns the keys starting with prefix the txn sees, in order
+func (t *memoryTxn) keys(prefix []byte) []string {
+	var keys []string
+
+	p := string(prefix)
+	for key := range t.store.data {
+		if strings.HasPrefix(key, p) && !t.deleted[key] {
+			if _, ok := t.pending[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for key := range t.pending {
+		if strings.HasPrefix(key, p) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (t *memoryTxn) Iterate(prefix []byte, fn func(key, value []byte) bool) error {
+	for _, key := range t.keys(prefix) {
+		value, err := t.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if !fn([]byte(key), value) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (t *memoryTxn) IterateReverse(prefix, before []byte, fn func(key, value []byte) bool) error {
+	keys := t.keys(prefix)
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		if before != nil && keys[i] >= string(before) {
+			continue
+		}
+		value, err := t.Get([]byte(keys[i]))
+		if err != nil {
+			return err
+		}
+		if !fn([]byte(keys[i]), value) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (b *memoryBatch) Set(key, value []byte) error {
+	return b.store.Update(func(txn StoreTxn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	return b.store.Update(func(txn StoreTxn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (b *memoryBatch) Flush() error {
+	return nil
+}
@@ -0,0 +1,420 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	//Mempool holds the valid transactions waiting to be forged, the ones whose
+	//lock time has not come yet too. A pooled transaction can spend the
+	//outputs of another one, but no output is spent twice: a transaction
+	//spending outputs already spent in the pool replaces their spenders when
+	//it pays more. It is safe for concurrent use
+	Mempool struct {
+		chain   *Blockchain
+		maxTxs  int
+		maxSize int
+
+		mutex sync.Mutex
+		txs   map[string]*poolEntry
+		//order keeps the IDs in the order they came, parents before children
+		order []string
+		//spent maps every outpoint spent in the pool to the ID of its spender
+		spent map[string]string
+		size  int
+	}
+
+	poolEntry struct {
+		tx   Transaction
+		fee  int
+		size int
+	}
+)
+
+const (
+	//MaxPoolTxs is how many transactions a node keeps pending by default
+	MaxPoolTxs = 5000
+	//MaxPoolSize is how many encoded bytes of transactions a node keeps
+	//pending by default
+	MaxPoolSize = 1 << 20
+)
+
+var (
+	ErrTxInPool          = errors.New("transaction is already pending")
+	ErrPoolConflict      = errors.New("output is already spent by a pending transaction")
+	ErrPoolFull          = errors.New("pending pool is full of transactions paying more")
+	ErrLowReplacementFee = errors.New("replacement does not pay more than the transactions it replaces")
+)
+
+func outpoint(txID []byte, outIdx int) string {
+	return fmt.Sprintf("%x:%d", txID, outIdx)
+}
+
+//NewMempool makes an empty pool for chain that keeps at most maxTxs
+//transactions and maxSize encoded bytes
+func NewMempool(chain *Blockchain, maxTxs, maxSize int) *Mempool {
+	return &Mempool{
+		chain:   chain,
+		maxTxs:  maxTxs,
+		maxSize: maxSize,
+		txs:     make(map[string]*poolEntry),
+		spent:   make(map[string]string),
+	}
+}
+
+//Add checks tx against the chain and the pool and keeps it. A tx spending
+//outputs that pooled transactions spend replaces them and their descendants
+//when its fee is higher than all of theirs together. When the pool is over
+//its limits the transactions paying the lowest fee per byte are evicted. When
+//that is tx itself the pool is left as it was and Add returns ErrPoolFull
+func (pool *Mempool) Add(tx *Transaction) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return pool.add(tx)
+}
+
+func (pool *Mempool) add(tx *Transaction) error {
+	id := hex.EncodeToString(tx.ID)
+	if _, ok := pool.txs[id]; ok {
+		return fmt.Errorf("%w: %s", ErrTxInPool, id)
+	}
+
+	entry, err := pool.check(tx)
+	if err != nil {
+		return err
+	}
+	if entry.size > pool.maxSize {
+		return fmt.Errorf("%w: %s is larger than the pool", ErrPoolFull, id)
+	}
+
+	replaced := pool.replaced(tx)
+	if len(replaced) > 0 {
+		replacedFee := 0
+		for _, other := range replaced {
+			for _, in := range tx.Inputs {
+				if hex.EncodeToString(in.ID) == other {
+					return fmt.Errorf("%w: %s spends %s", ErrPoolConflict, id, other)
+				}
+			}
+			replacedFee += pool.txs[other].fee
+		}
+		if entry.fee <= replacedFee {
+			return fmt.Errorf("%w: %d is not above %d", ErrLowReplacementFee, entry.fee, replacedFee)
+		}
+	}
+
+	//the pool is put back as it was when tx does not stay
+	order := append([]string{}, pool.order...)
+	var removed []*poolEntry
+	for _, other := range replaced {
+		removed = append(removed, pool.remove(other))
+	}
+
+	pool.insert(entry)
+
+	for len(pool.order) > pool.maxTxs || pool.size > pool.maxSize {
+		removed = append(removed, pool.removeWithDescendants(pool.lowestFeeRate())...)
+	}
+	if _, ok := pool.txs[id]; !ok {
+		for _, other := range removed {
+			if other != entry {
+				pool.insert(other)
+			}
+		}
+		pool.order = order
+		return fmt.Errorf("%w: %s", ErrPoolFull, id)
+	}
+
+	return nil
+}
+
+//check verifies tx like VerifyTransaction, with the pooled transactions as
+//parents. Outputs spent by other pooled transactions are left to Add
+func (pool *Mempool) check(tx *Transaction) (*poolEntry, error) {
+	if tx.IsCoinbase() {
+		return nil, ruleError(ErrBadCoinbase, "%x is a coinbase", tx.ID)
+	}
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return nil, ruleError(ErrBadTxID, "%x", tx.ID)
+	}
+
+	parents, err := pool.parents(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := 0
+	err = pool.chain.Database.View(func(txn StoreTxn) error {
+		next, err := pool.chain.tipSpendContext(txn)
+		if err != nil {
+			return err
+		}
+
+		fee, err = pool.chain.verifyBlockTransaction(txn, tx, parents, next)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &poolEntry{*tx, fee, len(tx.Serialize())}, nil
+}
+
+//parents returns the pooled transactions tx spends from. Every other input
+//has to spend an output of the UTXO index, once
+func (pool *Mempool) parents(tx *Transaction) (map[string]Transaction, error) {
+	parents := make(map[string]Transaction)
+	seen := make(map[string]bool)
+	utxo := UTXOSet{pool.chain}
+
+	for _, in := range tx.Inputs {
+		point := outpoint(in.ID, in.Out)
+		if seen[point] {
+			return nil, ruleError(ErrDoubleSpend, point)
+		}
+		seen[point] = true
+
+		id := hex.EncodeToString(in.ID)
+		if parent, ok := pool.txs[id]; ok {
+			parents[id] = parent.tx
+			continue
+		}
+
+		unspent, err := utxo.IsUnspent(in.ID, in.Out)
+		if err != nil {
+			return nil, err
+		}
+		if !unspent {
+			return nil, ruleError(ErrMissingInput, point)
+		}
+	}
+
+	return parents, nil
+}
+
+func (pool *Mempool) insert(entry *poolEntry) {
+	id := hex.EncodeToString(entry.tx.ID)
+
+	pool.txs[id] = entry
+	pool.order = append(pool.order, id)
+	for _, in := range entry.tx.Inputs {
+		pool.spent[outpoint(in.ID, in.Out)] = id
+	}
+	pool.size += entry.size
+}
+
+//remove drops id from the pool and returns its entry, nil when it is not
+//pooled
+func (pool *Mempool) remove(id string) *poolEntry {
+	entry, ok := pool.txs[id]
+	if !ok {
+		return nil
+	}
+
+	for _, in := range entry.tx.Inputs {
+		delete(pool.spent, outpoint(in.ID, in.Out))
+	}
+	delete(pool.txs, id)
+	for i, other := range pool.order {
+		if other == id {
+			pool.order = append(pool.order[:i], pool.order[i+1:]...)
+			break
+		}
+	}
+	pool.size -= entry.size
+
+	return entry
+}
+
+//replaced returns the IDs of the pooled transactions that spend the same
+//outputs as tx, followed by their descendants
+func (pool *Mempool) replaced(tx *Transaction) []string {
+	var found []string
+	seen := make(map[string]bool)
+
+	for _, in := range tx.Inputs {
+		spender, ok := pool.spent[outpoint(in.ID, in.Out)]
+		if !ok || seen[spender] {
+			continue
+		}
+		for _, id := range append([]string{spender}, pool.descendants(spender)...) {
+			if !seen[id] {
+				seen[id] = true
+				found = append(found, id)
+			}
+		}
+	}
+
+	return found
+}
+
+//descendants returns the IDs of the pooled transactions that spend the
+//outputs of id, directly or not
+func (pool *Mempool) descendants(id string) []string {
+	var found []string
+
+	for queue := []string{id}; len(queue) > 0; queue = queue[1:] {
+		entry, ok := pool.txs[queue[0]]
+		if !ok {
+			continue
+		}
+		for i := range entry.tx.Outputs {
+			if child, ok := pool.spent[outpoint(entry.tx.ID, i)]; ok {
+				found = append(found, child)
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return found
+}
+
+//removeWithDescendants drops id and every pooled transaction spending its
+//outputs and returns their entries
+func (pool *Mempool) removeWithDescendants(id string) []*poolEntry {
+	var removed []*poolEntry
+
+	for _, child := range pool.descendants(id) {
+		if entry := pool.remove(child); entry != nil {
+			removed = append(removed, entry)
+		}
+	}
+	if entry := pool.remove(id); entry != nil {
+		removed = append(removed, entry)
+	}
+
+	return removed
+}
+
+//lowestFeeRate returns the ID of the pooled transaction paying the lowest fee
+//per byte, the newest one among equals
+func (pool *Mempool) lowestFeeRate() string {
+	var lowest *poolEntry
+
+	for _, id := range pool.order {
+		entry := pool.txs[id]
+		if lowest == nil || entry.fee*lowest.size <= lowest.fee*entry.size {
+			lowest = entry
+		}
+	}
+
+	return hex.EncodeToString(lowest.tx.ID)
+}
+
+//RemoveBlock drops the transactions a block confirmed and the ones that spend
+//the same outputs, with their descendants
+func (pool *Mempool) RemoveBlock(block *Block) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for _, tx := range block.Transaction {
+		id := hex.EncodeToString(tx.ID)
+		pool.remove(id)
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if spender, ok := pool.spent[outpoint(in.ID, in.Out)]; ok && spender != id {
+				pool.removeWithDescendants(spender)
+			}
+		}
+	}
+}
+
+//UpdateTip makes the pool follow the main chain once ProcessBlock moved it.
+//When the tip was only extended the transactions the new blocks confirmed or
+//conflict with are dropped. After a reorganization the transactions of the
+//disconnected blocks are pooled again and everything pooled is checked
+//against the new tip
+func (pool *Mempool) UpdateTip(update TipUpdate) {
+	if len(update.Disconnected) == 0 {
+		for _, block := range update.Connected {
+			pool.RemoveBlock(block)
+		}
+		return
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	//the disconnected transactions go first, oldest first, as the pooled
+	//ones may spend their outputs
+	var txs []Transaction
+	for i := len(update.Disconnected) - 1; i >= 0; i-- {
+		for _, tx := range update.Disconnected[i].Transaction {
+			if !tx.IsCoinbase() {
+				txs = append(txs, *tx)
+			}
+		}
+	}
+	for _, id := range pool.order {
+		txs = append(txs, pool.txs[id].tx)
+	}
+
+	pool.txs = make(map[string]*poolEntry)
+	pool.order = nil
+	pool.spent = make(map[string]string)
+	pool.size = 0
+
+	for i := range txs {
+		pool.add(&txs[i])
+	}
+}
+
+//Transactions returns the pooled transactions the block at height forged at
+//timestamp can hold, parents before children, and the sum of their fees.
+//Transactions still locked stay pooled, and so do their descendants
+func (pool *Mempool) Transactions(height int, timestamp int64) ([]*Transaction, int) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	var (
+		txs  []*Transaction
+		fees int
+	)
+	locked := make(map[string]bool)
+	for _, id := range pool.order {
+		entry := pool.txs[id]
+		if !entry.tx.IsFinal(height, timestamp) {
+			locked[id] = true
+			for _, child := range pool.descendants(id) {
+				locked[child] = true
+			}
+		}
+		if locked[id] {
+			continue
+		}
+
+		tx := entry.tx
+		txs = append(txs, &tx)
+		fees += entry.fee
+	}
+
+	return txs, fees
+}
+
+//Get returns the pooled transaction with ID id
+func (pool *Mempool) Get(id []byte) (Transaction, bool) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	entry, ok := pool.txs[hex.EncodeToString(id)]
+	if !ok {
+		return Transaction{}, false
+	}
+	return entry.tx, true
+}
+
+//Count returns how many transactions are pooled
+func (pool *Mempool) Count() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return len(pool.order)
+}
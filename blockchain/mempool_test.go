@@ -0,0 +1,347 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestMempoolUpdateTipExtend(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+	pool := NewMempool(chain, MaxPoolTxs, MaxPoolSize)
+
+	tx, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(tx); !errors.Is(err, ErrTxInPool) {
+		t.Fatalf("same transaction twice: got %v, want %v", err, ErrTxInPool)
+	}
+
+	block := newTestBlock(t, tipBlock(t, chain), forger, chain.Config.BlockSubsidy(1)+1, tx)
+	update, err := chain.ProcessBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Connected) != 1 || len(update.Disconnected) != 0 {
+		t.Fatalf("extending the tip connected %d and disconnected %d blocks", len(update.Connected), len(update.Disconnected))
+	}
+	pool.UpdateTip(update)
+
+	if pool.Count() != 0 {
+		t.Fatalf("%d transactions pending after the block confirmed them", pool.Count())
+	}
+}
+
+func TestMempoolUpdateTipReorganize(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, c, forger := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	pool := NewMempool(chain, MaxPoolTxs, MaxPoolSize)
+	genesis := tipBlock(t, chain)
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := addTestBlock(t, chain, genesis, forger, 1, toB)
+
+	//pending on top of m1, spending what it paid b
+	toC := spendOutput(t, b, toB, 0, c, 4, 1)
+	if err := pool.Add(toC); err != nil {
+		t.Fatal(err)
+	}
+
+	s1 := addTestBlock(t, chain, genesis, forger, 0)
+	s2 := newTestBlock(t, s1, forger, chain.Config.BlockSubsidy(2))
+	update, err := chain.ProcessBlock(s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Disconnected) != 1 || !bytes.Equal(update.Disconnected[0].Hash, m1.Hash) {
+		t.Fatalf("reorganization disconnected %d blocks, want m1", len(update.Disconnected))
+	}
+	if len(update.Connected) != 2 {
+		t.Fatalf("reorganization connected %d blocks, want 2", len(update.Connected))
+	}
+	pool.UpdateTip(update)
+
+	for _, tx := range []*Transaction{toB, toC} {
+		if _, ok := pool.Get(tx.ID); !ok {
+			t.Errorf("%x is not pending after the reorganization", tx.ID)
+		}
+	}
+	txs, fees := pool.Transactions(3, s2.Timestamp)
+	if len(txs) != 2 || fees != 2 || !bytes.Equal(txs[0].ID, toB.ID) {
+		t.Fatalf("pool forges %d transactions paying %d, want toB then toC paying 2", len(txs), fees)
+	}
+}
+
+func TestBumpFeePendingParent(t *testing.T) {
+	chain, a := newTestChain(t)
+	b := newTestWallet(t)
+	pool := NewMempool(chain, MaxPoolTxs, MaxPoolSize)
+	UTXO := &UTXOSet{chain}
+
+	//a pays itself, every output goes back to a but only the last is change
+	self, err := NewTransaction(a, string(a.Address()), string(a.Address()), 20, 1, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(self); err != nil {
+		t.Fatal(err)
+	}
+	child := spendOutput(t, a, self, 0, b, 5, 1)
+	if err := pool.Add(child); err != nil {
+		t.Fatal(err)
+	}
+
+	parents := map[string]Transaction{hex.EncodeToString(self.ID): *self}
+	if _, err := BumpFee(a, child, parents, 0, 3, UTXO); err == nil {
+		t.Fatal("output paying b taken as change")
+	}
+	if _, err := BumpFee(a, child, nil, 1, 3, UTXO); !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("pending parent not given: got %v, want %v", err, ErrMissingInput)
+	}
+
+	bumped, err := BumpFee(a, child, parents, 1, 3, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bumped.Outputs[1].Value; got != 12 {
+		t.Fatalf("change of the replacement is %d, want 12", got)
+	}
+	if err := pool.Add(bumped); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pool.Get(child.ID); ok {
+		t.Fatal("replaced transaction still pending")
+	}
+
+	//replacing the parent drops the child, so it pays for both
+	bumped, err = BumpFee(a, self, nil, 1, 5, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bumped.Outputs[0].Value; got != 20 {
+		t.Fatalf("payment of a to itself is %d, want 20", got)
+	}
+	if got := bumped.Outputs[1].Value; got != 25 {
+		t.Fatalf("change of the replacement is %d, want 25", got)
+	}
+	if err := pool.Add(bumped); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Count() != 1 {
+		t.Fatalf("%d transactions pending, want the replacement only", pool.Count())
+	}
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, c := newTestWallet(t), newTestWallet(t)
+	pool := NewMempool(chain, MaxPoolTxs, MaxPoolSize)
+	UTXO := &UTXOSet{chain}
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(toB); err != nil {
+		t.Fatal(err)
+	}
+	child := spendOutput(t, b, toB, 0, c, 5, 1)
+	if err := pool.Add(child); err != nil {
+		t.Fatal(err)
+	}
+
+	//spends the genesis output too, so it has to pay more than toB and child
+	low, err := NewTransaction(a, string(a.Address()), string(c.Address()), 10, 2, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(low); !errors.Is(err, ErrLowReplacementFee) {
+		t.Fatalf("replacement paying 2: got %v, want %v", err, ErrLowReplacementFee)
+	}
+	if pool.Count() != 2 {
+		t.Fatalf("%d transactions pending after a rejected replacement, want 2", pool.Count())
+	}
+
+	toC, err := NewTransaction(a, string(a.Address()), string(c.Address()), 10, 3, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(toC); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Count() != 1 {
+		t.Fatalf("%d transactions pending after the replacement, want 1", pool.Count())
+	}
+	for _, replaced := range []*Transaction{toB, child} {
+		if _, ok := pool.Get(replaced.ID); ok {
+			t.Fatalf("%x still pending after its replacement", replaced.ID)
+		}
+	}
+	if _, ok := pool.Get(toC.ID); !ok {
+		t.Fatal("replacement not pending")
+	}
+}
+
+//splitOutput pays output out of prev, owned by from, to to in n parts, all
+//but fee
+func splitOutput(t *testing.T, from *wallet.Wallet, prev *Transaction, out int, to *wallet.Wallet, n, fee int) *Transaction {
+	t.Helper()
+
+	value := prev.Outputs[out].Value - fee
+	tx := Transaction{nil, []TxInput{{prev.ID, string(from.Address()), out, nil, from.Publickey, nil, nil}}, nil, 0}
+	for i := 0; i < n; i++ {
+		amount := value / n
+		if i == n-1 {
+			amount += value % n
+		}
+		output, err := NewTxOutput(amount, string(to.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Outputs = append(tx.Outputs, *output)
+	}
+
+	if err := tx.Sign(from.PrivateKey, map[string]Transaction{hex.EncodeToString(prev.ID): *prev}); err != nil {
+		t.Fatal(err)
+	}
+	tx.ID = tx.Hash()
+	return &tx
+}
+
+//newSplitChain is a chain whose genesis allocation was split in n outputs
+//of the same wallet, confirmed at height 1
+func newSplitChain(t *testing.T, n int) (*Blockchain, *wallet.Wallet, *Transaction) {
+	t.Helper()
+
+	chain, a := newTestChain(t)
+	genesis := tipBlock(t, chain)
+	split := splitOutput(t, a, genesis.Transaction[0], 0, a, n, 0)
+	addTestBlock(t, chain, genesis, newTestWallet(t), 0, split)
+
+	return chain, a, split
+}
+
+func TestMempoolCountLimit(t *testing.T) {
+	chain, a, split := newSplitChain(t, 4)
+	b := newTestWallet(t)
+	pool := NewMempool(chain, 2, MaxPoolSize)
+
+	fee2 := spendOutput(t, a, split, 0, b, 5, 2)
+	fee3 := spendOutput(t, a, split, 1, b, 5, 3)
+	for _, tx := range []*Transaction{fee2, fee3} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fee1 := spendOutput(t, a, split, 2, b, 5, 1)
+	if err := pool.Add(fee1); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("cheapest transaction in a full pool: got %v, want %v", err, ErrPoolFull)
+	}
+	if _, ok := pool.Get(fee1.ID); ok || pool.Count() != 2 {
+		t.Fatalf("%d transactions pending after the cheapest was refused, want 2", pool.Count())
+	}
+
+	fee4 := spendOutput(t, a, split, 3, b, 5, 4)
+	if err := pool.Add(fee4); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pool.Get(fee2.ID); ok {
+		t.Fatal("lowest fee rate still pending in a full pool")
+	}
+	for _, tx := range []*Transaction{fee3, fee4} {
+		if _, ok := pool.Get(tx.ID); !ok {
+			t.Fatalf("%x evicted instead of the lowest fee rate", tx.ID)
+		}
+	}
+}
+
+func TestMempoolSizeLimit(t *testing.T) {
+	chain, a, split := newSplitChain(t, 3)
+	b := newTestWallet(t)
+
+	fee1 := spendOutput(t, a, split, 0, b, 5, 1)
+	fee2 := spendOutput(t, a, split, 1, b, 5, 2)
+	fee3 := spendOutput(t, a, split, 2, b, 5, 3)
+	//holds two of them and a half
+	maxSize := len(fee1.Serialize()) + len(fee2.Serialize()) + len(fee3.Serialize())/2
+	pool := NewMempool(chain, MaxPoolTxs, maxSize)
+
+	for _, tx := range []*Transaction{fee1, fee2, fee3} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pool.Count() != 2 {
+		t.Fatalf("%d transactions pending in a pool holding 2, want 2", pool.Count())
+	}
+	if _, ok := pool.Get(fee1.ID); ok {
+		t.Fatal("lowest fee rate still pending in a full pool")
+	}
+
+	//replaces fee3 and pays more than fee2, but is so large its rate is the
+	//lowest and it is evicted
+	large := splitOutput(t, a, split, 2, b, 8, 4)
+	if err := pool.Add(large); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("large replacement in a full pool: got %v, want %v", err, ErrPoolFull)
+	}
+	for _, tx := range []*Transaction{fee2, fee3} {
+		if _, ok := pool.Get(tx.ID); !ok {
+			t.Fatalf("%x lost to a replacement that did not stay", tx.ID)
+		}
+	}
+
+	huge := splitOutput(t, a, split, 0, b, 100, 10)
+	if len(huge.Serialize()) <= maxSize {
+		t.Fatal("transaction is not larger than the pool")
+	}
+	if err := pool.Add(huge); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("transaction larger than the pool: got %v, want %v", err, ErrPoolFull)
+	}
+}
+
+func TestMempoolConflict(t *testing.T) {
+	chain, a, split := newSplitChain(t, 2)
+	b := newTestWallet(t)
+	pool := NewMempool(chain, MaxPoolTxs, MaxPoolSize)
+
+	toB := spendOutput(t, a, split, 0, b, 5, 1)
+	if err := pool.Add(toB); err != nil {
+		t.Fatal(err)
+	}
+
+	//spends the output toB spends and the change of toB, so it would replace
+	//its own parent
+	tx := Transaction{nil, []TxInput{
+		{split.ID, string(a.Address()), 0, nil, a.Publickey, nil, nil},
+		{toB.ID, string(a.Address()), 1, nil, a.Publickey, nil, nil},
+	}, nil, 0}
+	output, err := NewTxOutput(40, string(b.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Outputs = []TxOutput{*output}
+	prevTxs := map[string]Transaction{hex.EncodeToString(split.ID): *split, hex.EncodeToString(toB.ID): *toB}
+	if err := tx.Sign(a.PrivateKey, prevTxs); err != nil {
+		t.Fatal(err)
+	}
+	tx.ID = tx.Hash()
+
+	if err := pool.Add(&tx); !errors.Is(err, ErrPoolConflict) {
+		t.Fatalf("transaction replacing its parent: got %v, want %v", err, ErrPoolConflict)
+	}
+	if _, ok := pool.Get(toB.ID); !ok || pool.Count() != 1 {
+		t.Fatal("pool changed after a conflicting transaction")
+	}
+}
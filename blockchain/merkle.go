@@ -1,10 +1,16 @@
 package blockchain
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
 
 type (
 	MerkleTree struct {
 		RootNode *MerkleNode
+		//levels holds every level of the tree from the leaves up to the root
+		levels [][]*MerkleNode
 	}
 
 	//recursive tree structure
@@ -13,52 +19,122 @@ type (
 		Right *MerkleNode
 		Data  []byte
 	}
+
+	//MerkleProof is the path from a leaf to the root: the sibling hash at
+	//every level, from the leaves up. The bits of Index tell on which side
+	//each sibling is
+	MerkleProof struct {
+		Index  int
+		Hashes [][]byte
+	}
+)
+
+var (
+	ErrNoMerkleLeaf = errors.New("leaf is not in the merkle tree")
 )
 
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
-	node := MerkleNode{}
+	node := MerkleNode{Left: left, Right: right}
 
 	if left == nil && right == nil {
 		hash := sha256.Sum256(data)
 		node.Data = hash[:]
 	} else {
-		prevHashes := append(left.Data, right.Data...)
-		hash := sha256.Sum256(prevHashes)
-		node.Data = hash[:]
+		node.Data = hashPair(left.Data, right.Data)
 	}
 
 	return &node
 }
 
+func hashPair(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return hash[:]
+}
+
+//NewMerkleTree builds a tree over data. A level with an odd number of nodes
+//pairs its last node with itself
 func NewMerkleTree(data [][]byte) *MerkleTree {
 	var (
-		nodes []MerkleNode
+		nodes []*MerkleNode
 	)
 
-	//check to make the Merkle tree leaves even
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		return &MerkleTree{&MerkleNode{}, nil}
 	}
 
-	//adding data to array but not on Merkle Tree format
 	for _, dat := range data {
-		node := NewMerkleNode(nil, nil, dat)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, NewMerkleNode(nil, nil, dat))
 	}
 
-	//Making the data on array to Merkle Tree Format
-	for i := 0; i < len(data)/2; i++ {
-		var level []MerkleNode
+	tree := MerkleTree{}
+	tree.levels = append(tree.levels, nodes)
+
+	for len(nodes) > 1 {
+		var level []*MerkleNode
 
 		for k := 0; k < len(nodes); k += 2 {
-			node := NewMerkleNode(&nodes[k], &nodes[k+1], nil)
-			level = append(level, *node)
+			right := nodes[k]
+			if k+1 < len(nodes) {
+				right = nodes[k+1]
+			}
+			level = append(level, NewMerkleNode(nodes[k], right, nil))
 		}
 
+		tree.levels = append(tree.levels, level)
 		nodes = level
 	}
 
-	tree := MerkleTree{&nodes[0]}
+	tree.RootNode = nodes[0]
 
 	return &tree
 }
+
+//Proof returns the inclusion proof of the leaf at index
+func (t *MerkleTree) Proof(index int) (MerkleProof, error) {
+	proof := MerkleProof{Index: index}
+
+	if len(t.levels) == 0 || index < 0 || index >= len(t.levels[0]) {
+		return proof, ErrNoMerkleLeaf
+	}
+
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		proof.Hashes = append(proof.Hashes, level[sibling].Data)
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+//VerifyMerkleProof checks that the transaction with ID txHash is in the block
+//with merkle root root. Leaves and inner nodes are hashed alike, so txHash has
+//to be a transaction ID: 64 bytes would be taken for the two children of an
+//inner node
+func VerifyMerkleProof(root, txHash []byte, proof MerkleProof) bool {
+	if len(txHash) != sha256.Size {
+		return false
+	}
+	if proof.Index < 0 || proof.Index >= 1<<uint(len(proof.Hashes)) {
+		return false
+	}
+
+	hash := NewMerkleNode(nil, nil, txHash).Data
+	index := proof.Index
+
+	for _, sibling := range proof.Hashes {
+		if len(sibling) != sha256.Size {
+			return false
+		}
+		if index&1 == 0 {
+			hash = hashPair(hash, sibling)
+		} else {
+			hash = hashPair(sibling, hash)
+		}
+		index /= 2
+	}
+
+	return bytes.Equal(hash, root)
+}
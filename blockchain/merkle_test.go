@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func testLeaves(n int) [][]byte {
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		hash := sha256.Sum256([]byte{byte(i)})
+		leaves = append(leaves, hash[:])
+	}
+	return leaves
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		leaves := testLeaves(n)
+		tree := NewMerkleTree(leaves)
+		root := tree.RootNode.Data
+
+		for i, leaf := range leaves {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMerkleProof(root, leaf, proof) {
+				t.Fatalf("%d leaves: proof of leaf %d rejected", n, i)
+			}
+
+			other := leaves[(i+1)%n]
+			if n > 1 && VerifyMerkleProof(root, other, proof) {
+				t.Fatalf("%d leaves: proof of leaf %d taken for another leaf", n, i)
+			}
+			if len(proof.Hashes) > 0 {
+				proof.Hashes[0] = append([]byte{}, proof.Hashes[0]...)
+				proof.Hashes[0][0] ^= 1
+				if VerifyMerkleProof(root, leaf, proof) {
+					t.Fatalf("%d leaves: tampered proof of leaf %d verified", n, i)
+				}
+			}
+		}
+
+		if _, err := tree.Proof(n); err != ErrNoMerkleLeaf {
+			t.Fatalf("%d leaves: proof past the last leaf: got %v, want %v", n, err, ErrNoMerkleLeaf)
+		}
+	}
+}
+
+func TestMerkleProofInnerNode(t *testing.T) {
+	leaves := testLeaves(4)
+	tree := NewMerkleTree(leaves)
+
+	//the two children of the inner node over leaves 0 and 1, proven as a
+	//leaf one level up
+	inner := append(append([]byte{}, tree.levels[0][0].Data...), tree.levels[0][1].Data...)
+	proof, err := tree.Proof(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof = MerkleProof{0, proof.Hashes[1:]}
+
+	if VerifyMerkleProof(tree.RootNode.Data, inner, proof) {
+		t.Fatal("inner node proven as a transaction")
+	}
+}
@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type (
+	//legacyBlock decodes the gob encoding blocks were stored with, both before
+	//and after the header was split out of the block
+	legacyBlock struct {
+		BlockHeader BlockHeader
+		Hash        []byte
+		Transaction []*Transaction
+		PrevHash    []byte
+		Height      int
+		Validator   string
+		Timestamp   int64
+	}
+)
+
+func deserializeLegacyBlock(data []byte) (*Block, error) {
+	var legacy legacyBlock
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	block := Block{legacy.BlockHeader, legacy.Hash, legacy.Transaction}
+	if block.Version == LegacyBlockVersion {
+		//blocks from before BlockHeader belong to the default chain, they keep
+		//the hash they were stored under
+		block.BlockHeader = BlockHeader{LegacyBlockVersion, legacy.PrevHash, block.HashTransactions(), legacy.Height, legacy.Timestamp, legacy.Validator, DefaultChainID}
+	}
+
+	return &block, nil
+}
+
+//MigrateStorage re-encodes the blocks of the main chain that are still stored
+//with gob, down to chain.Base on a pruned chain or one started from a
+//snapshot. Blocks keep their hash and transactions keep their ID, so the
+//indexes stay valid, and blocks from before BlockHeader get
+//LegacyBlockVersion. It returns how many blocks were re-encoded
+func (chain *Blockchain) MigrateStorage() (int, error) {
+	count := 0
+	batch := chain.Database.NewBatch()
+
+	for hash := chain.LastHash; len(hash) > 0; {
+		var data []byte
+
+		err := chain.Database.View(func(txn StoreTxn) error {
+			var err error
+			data, err = txn.Get(hash)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+
+		block, err := Deserialize(data)
+		if err != nil {
+			return count, err
+		}
+
+		if !isCanonical(data) {
+			if err := batch.Set(headerKey(block.Hash), block.BlockHeader.Serialize()); err != nil {
+				return count, err
+			}
+			if err := batch.Set(block.Hash, block.Serialize()); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if block.Height <= chain.Base {
+			break
+		}
+		hash = block.PrevHash
+	}
+
+	return count, batch.Flush()
+}
+
+//checkLegacyBlock is what is left of ValidateBlock for a block of
+//LegacyBlockVersion: it has to continue the legacy blocks of the chain and
+//its merkle root has to match its transaction IDs
+func (chain *Blockchain) checkLegacyBlock(block *Block) error {
+	if len(block.Transaction) == 0 {
+		return ruleError(ErrNoTransactions, "%x", block.Hash)
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ruleError(ErrBadMerkleRoot, "%x", block.Hash)
+	}
+
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return ruleError(ErrUnknownParent, "%x", block.PrevHash)
+	}
+	if parent.Version != LegacyBlockVersion {
+		return ruleError(ErrBadVersion, "legacy block %x follows a block of version %d", block.Hash, parent.Version)
+	}
+
+	if block.ChainID != parent.ChainID {
+		return ruleError(ErrBadChainID, "%s", block.ChainID)
+	}
+	if block.Height != parent.Height+1 {
+		return ruleError(ErrBadHeight, "got %d, parent is %d", block.Height, parent.Height)
+	}
+
+	return nil
+}
+
+//createLegacyBlockchain writes a genesis block of LegacyBlockVersion from an
+//export into an empty store, after the checks ValidateGenesis can still make
+func createLegacyBlockchain(store ChainStore, genesis *Block) (*Blockchain, error) {
+	if len(genesis.Transaction) == 0 {
+		return nil, ruleError(ErrNoTransactions, "%x", genesis.Hash)
+	}
+
+	if !bytes.Equal(genesis.MerkleRoot, genesis.HashTransactions()) {
+		return nil, ruleError(ErrBadMerkleRoot, "%x", genesis.Hash)
+	}
+
+	for _, tx := range genesis.Transaction {
+		if !tx.IsCoinbase() {
+			return nil, ruleError(ErrBadCoinbase, "%x", tx.ID)
+		}
+	}
+
+	return writeGenesis(store, genesis, nil)
+}
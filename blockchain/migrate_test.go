@@ -0,0 +1,161 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestMigrateStoragePruned(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger := newTestWallet(t)
+
+	parent := tipBlock(t, chain)
+	for i := 0; i < 15; i++ {
+		parent = addTestBlock(t, chain, parent, forger, 0)
+	}
+	if _, err := chain.SetPruning(MinPruneKeep); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Base == 0 {
+		t.Fatal("nothing pruned")
+	}
+
+	//the tip as it was stored before the header was split out of the block
+	var buffer bytes.Buffer
+	legacy := legacyBlock{BlockHeader: parent.BlockHeader, Hash: parent.Hash, Transaction: parent.Transaction}
+	if err := gob.NewEncoder(&buffer).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	err := chain.Database.Update(func(txn StoreTxn) error {
+		return txn.Set(parent.Hash, buffer.Bytes())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := chain.MigrateStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("%d blocks re-encoded, want 1", count)
+	}
+
+	block, err := chain.GetBlock(parent.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.BlockHashing(), parent.Hash) {
+		t.Fatal("re-encoded block changed its hash")
+	}
+}
+
+//newLegacyBlock stores block as it was before BlockHeader, with made up gob
+//era transaction IDs and block hash, and connects it
+func newLegacyBlock(t *testing.T, store ChainStore, prev *Block, txs ...*Transaction) *Block {
+	t.Helper()
+
+	legacy := legacyBlock{Transaction: txs, PrevHash: []byte{}, Validator: "", Timestamp: 1600000000}
+	if prev != nil {
+		legacy.PrevHash, legacy.Height = prev.Hash, prev.Height+1
+	}
+	hash := sha256.Sum256(append([]byte("gob"), byte(legacy.Height)))
+	legacy.Hash = hash[:]
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	block, err := deserializeLegacyBlock(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Update(func(txn StoreTxn) error {
+		if err := txn.Set(block.Hash, buffer.Bytes()); err != nil {
+			return err
+		}
+		return connectBlock(txn, block)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestMigrateLegacyChain(t *testing.T) {
+	a, b, forger := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	//transaction IDs of the gob era, which the current hashing does not give
+	legacyID := func(tx *Transaction, seed string) *Transaction {
+		id := sha256.Sum256([]byte(seed))
+		tx.ID = id[:]
+		return tx
+	}
+	toA, err := CoinbaseTx(string(a.Address()), "", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reward, err := CoinbaseTx(string(forger.Address()), "", BlockReward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyID(toA, "genesis")
+	legacyID(reward, "reward")
+	payment := spendOutput(t, a, toA, 0, b, 10, 0)
+	legacyID(payment, "payment")
+
+	store := NewMemoryStore()
+	genesis := newLegacyBlock(t, store, nil, toA)
+	newLegacyBlock(t, store, genesis, reward, payment)
+
+	chain, err := LoadBlockchain(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := chain.MigrateStorage()
+	if err != nil || count != 2 {
+		t.Fatalf("%d blocks re-encoded, %v, want 2", count, err)
+	}
+	tip := addTestBlock(t, chain, tipBlock(t, chain), forger, 0)
+	balances := []int{balance(t, chain, a), balance(t, chain, b), balance(t, chain, forger)}
+	if balances[0] != 40 || balances[1] != 10 {
+		t.Fatalf("balances are %v after the migration", balances)
+	}
+
+	var export bytes.Buffer
+	if _, err := chain.Export(&export, 0, -1, func(int) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	//peers cannot send legacy blocks, an export can
+	fork := *tipBlock(t, chain)
+	fork.Hash = append([]byte{}, genesis.Hash...)
+	fork.Hash[0] ^= 0xff
+	fork.Version = LegacyBlockVersion
+	if err := chain.AddBlock(&fork); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("got %v, want %v", err, ErrBadVersion)
+	}
+
+	reader, err := NewExportReader(&export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, count, err := CreateBlockchainFromExport(NewMemoryStore(), reader, nil, func(int) {})
+	if err != nil || count != 3 {
+		t.Fatalf("%d blocks imported, %v, want 3", count, err)
+	}
+	if !bytes.Equal(imported.LastHash, tip.Hash) {
+		t.Fatalf("tip is %x, want %x", imported.LastHash, tip.Hash)
+	}
+	for i, w := range []*wallet.Wallet{a, b, forger} {
+		if got := balance(t, imported, w); got != balances[i] {
+			t.Fatalf("balance %d is %d after the import, want %d", i, got, balances[i])
+		}
+	}
+}
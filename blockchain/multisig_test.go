@@ -0,0 +1,84 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestMultisigSpend(t *testing.T) {
+	chain, a := newTestChain(t)
+	c, forger := newTestWallet(t), newTestWallet(t)
+	signers := []*wallet.Wallet{newTestWallet(t), newTestWallet(t), newTestWallet(t)}
+
+	var keys [][]byte
+	for _, w := range signers {
+		keys = append(keys, w.Publickey)
+	}
+	script, err := wallet.RedeemScript(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := string(wallet.MultisigAddress(script))
+
+	toMultisig, err := NewTransaction(a, string(a.Address()), address, 20, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := addTestBlock(t, chain, tipBlock(t, chain), forger, 1, toMultisig)
+
+	tx, err := NewMultisigTransaction(script, string(c.Address()), 10, 1, 0, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.MissingSignatures(); got != 2 {
+		t.Fatalf("%d signatures missing, want 2", got)
+	}
+
+	//a key outside the script adds nothing
+	if err := chain.SignTransaction(tx, c.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.SignTransaction(tx, signers[0].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.MissingSignatures(); got != 1 {
+		t.Fatalf("%d signatures missing after one co-signer, want 1", got)
+	}
+	if err := chain.VerifyTransaction(tx); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("one of two signatures: got %v, want %v", err, ErrBadSignature)
+	}
+
+	if err := chain.SignTransaction(tx, signers[2].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	//the signatures are part of the ID, like signtx does
+	tx.ID = tx.Hash()
+	if got := tx.MissingSignatures(); got != 0 {
+		t.Fatalf("%d signatures missing after two co-signers, want 0", got)
+	}
+	if err := chain.VerifyTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	//a signature moved to the slot of the key that did not sign
+	swapped := copyTransaction(tx)
+	signatures := append([][]byte{}, tx.Inputs[0].Signatures...)
+	for i, signature := range signatures {
+		if len(signature) == 0 {
+			signatures[i], signatures[(i+1)%len(signatures)] = signatures[(i+1)%len(signatures)], nil
+			break
+		}
+	}
+	swapped.Inputs[0].Signatures = signatures
+	swapped.ID = swapped.Hash()
+	if err := chain.VerifyTransaction(swapped); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("signature in the slot of another key: got %v, want %v", err, ErrBadSignature)
+	}
+
+	addTestBlock(t, chain, parent, forger, 1, tx)
+	if got := balance(t, chain, c); got != 10 {
+		t.Fatalf("balance of c is %d, want 10", got)
+	}
+}
@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	//MinPruneKeep is the fewest blocks a pruned chain keeps. Reorganizations
+	//deeper than the kept blocks cannot be followed
+	MinPruneKeep = 10
+)
+
+var (
+	//prune holds how many of the latest blocks a pruned chain keeps
+	pruneKey = []byte("prune")
+)
+
+func getPruning(txn StoreTxn) (int, error) {
+	v, err := txn.Get(pruneKey)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if len(v) != 8 {
+		return 0, fmt.Errorf("%w: pruning setting", ErrBadEncoding)
+	}
+	return int(binary.BigEndian.Uint64(v)), nil
+}
+
+//SetPruning makes the chain keep only the latest keep blocks from now on and
+//prunes the older ones, 0 turns pruning off. Pruned blocks are not brought back
+func (chain *Blockchain) SetPruning(keep int) (int, error) {
+	if keep != 0 && keep < MinPruneKeep {
+		return 0, fmt.Errorf("a pruned chain keeps at least %d blocks", MinPruneKeep)
+	}
+	if keep != 0 && keep < chain.Config.Params.CoinbaseMaturity {
+		return 0, fmt.Errorf("a pruned chain keeps at least the %d blocks of the coinbase maturity", chain.Config.Params.CoinbaseMaturity)
+	}
+
+	err := chain.Database.Update(func(txn StoreTxn) error {
+		if keep == 0 {
+			return txn.Delete(pruneKey)
+		}
+		return txn.Set(pruneKey, ToHex(int64(keep)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	chain.Prune = keep
+
+	return chain.PruneBlocks()
+}
+
+//PruneBlocks deletes the bodies, undo data and transaction index entries of
+//the main chain blocks older than the latest chain.Prune ones, and returns how
+//many were deleted. Headers, the UTXO set and the address history are kept,
+//and so is the genesis block
+func (chain *Blockchain) PruneBlocks() (int, error) {
+	if chain.Prune <= 0 {
+		return 0, nil
+	}
+
+	lastHeight, err := chain.GetLastHeight()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for keepFrom := lastHeight - chain.Prune + 1; chain.Base < keepFrom; {
+		height := chain.Base
+
+		err := chain.Database.Update(func(txn StoreTxn) error {
+			if height > 0 {
+				if err := pruneBlock(txn, height); err != nil {
+					return err
+				}
+			}
+
+			return txn.Set(baseKey, ToHex(int64(height+1)))
+		})
+		if err != nil {
+			return count, err
+		}
+
+		chain.Base = height + 1
+		if height > 0 {
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	return count, chain.Database.CollectGarbage()
+}
+
+func pruneBlock(txn StoreTxn, height int) error {
+	hash, err := txn.Get(heightKey(height))
+	if err != nil {
+		return err
+	}
+
+	block, err := getBlock(txn, hash)
+	if err != nil {
+		return err
+	}
+
+	//blocks stored before headers were kept on their own
+	if !hasKey(txn, headerKey(hash)) {
+		if err := putHeader(txn, hash, &block.BlockHeader); err != nil {
+			return err
+		}
+	}
+
+	if err := unindexTransactions(txn, block); err != nil {
+		return err
+	}
+
+	if err := txn.Delete(undoKey(hash)); err != nil {
+		return err
+	}
+
+	return txn.Delete(hash)
+}
@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPruneBlocks(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*Block{genesis, addTestBlock(t, chain, genesis, forger, 1, toB)}
+	for len(blocks) < 16 {
+		blocks = append(blocks, addTestBlock(t, chain, blocks[len(blocks)-1], forger, 0))
+	}
+	balances := [2]int{balance(t, chain, a), balance(t, chain, b)}
+	if _, err := chain.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GetTransaction(toB.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := chain.SetPruning(MinPruneKeep - 1); err == nil {
+		t.Fatalf("pruning kept fewer than %d blocks", MinPruneKeep)
+	}
+
+	//heights 1 to 5 go, 6 to 15 are kept
+	count, err := chain.SetPruning(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 || chain.Base != 6 {
+		t.Fatalf("%d blocks pruned, base %d, want 5 and 6", count, chain.Base)
+	}
+	for height, block := range blocks {
+		_, err := chain.GetBlock(block.Hash)
+		if pruned := height > 0 && height < 6; pruned && err != ErrBlockNotFound {
+			t.Fatalf("block %d: got %v, want %v", height, err, ErrBlockNotFound)
+		} else if !pruned && err != nil {
+			t.Fatalf("block %d: %s", height, err)
+		}
+		if header, err := chain.GetHeader(block.Hash); err != nil || header.Height != height {
+			t.Fatalf("header %d: height %d, %v", height, header.Height, err)
+		}
+	}
+	if got := [2]int{balance(t, chain, a), balance(t, chain, b)}; got != balances {
+		t.Fatalf("balances %v after pruning, want %v", got, balances)
+	}
+	if _, err := chain.GetTransaction(toB.ID); err == nil {
+		t.Fatal("transaction of a pruned block still indexed")
+	}
+
+	//new blocks prune the oldest kept one, the setting survives a reload
+	blocks = append(blocks, addTestBlock(t, chain, blocks[len(blocks)-1], forger, 0))
+	if chain.Base != 7 {
+		t.Fatalf("base %d after a new block, want 7", chain.Base)
+	}
+	reloaded, err := LoadBlockchain(chain.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Prune != 10 || reloaded.Base != 7 || !bytes.Equal(reloaded.LastHash, blocks[16].Hash) {
+		t.Fatalf("reloaded chain keeps %d from %d, want 10 from 7", reloaded.Prune, reloaded.Base)
+	}
+}
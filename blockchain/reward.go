@@ -0,0 +1,71 @@
+package blockchain
+
+//scheduledReward is the reward of the block at height before the supply cap:
+//BlockReward halved every HalvingInterval blocks
+func (params ConsensusParams) scheduledReward(height int) int {
+	if height <= 0 {
+		return 0
+	}
+	if params.HalvingInterval == 0 {
+		return params.BlockReward
+	}
+
+	halvings := (height - 1) / params.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return params.BlockReward >> uint(halvings)
+}
+
+//scheduledSupply is what the blocks up to height mint before the supply cap
+func (params ConsensusParams) scheduledSupply(height int) int {
+	if height <= 0 {
+		return 0
+	}
+	if params.HalvingInterval == 0 {
+		return height * params.BlockReward
+	}
+
+	supply := 0
+	for from := 1; from <= height; from += params.HalvingInterval {
+		reward := params.scheduledReward(from)
+		if reward == 0 {
+			break
+		}
+		blocks := params.HalvingInterval
+		if from+blocks-1 > height {
+			blocks = height - from + 1
+		}
+		supply += blocks * reward
+	}
+
+	return supply
+}
+
+//GenesisSupply is what the genesis block pays
+func (config *GenesisConfig) GenesisSupply() int {
+	supply := 0
+	for _, alloc := range config.Allocations {
+		supply += alloc.Amount
+	}
+	return supply
+}
+
+//BlockSubsidy is the value the coinbase of the block at height mints, fees
+//left aside. It follows the halving schedule and stops at MaxSupply
+func (config *GenesisConfig) BlockSubsidy(height int) int {
+	params := config.Params
+	if params.MaxSupply == 0 {
+		return params.scheduledReward(height)
+	}
+
+	left := params.MaxSupply - config.GenesisSupply()
+	minted := params.scheduledSupply(height - 1)
+	if minted >= left {
+		return 0
+	}
+	if reward := params.scheduledReward(height); reward < left-minted {
+		return reward
+	}
+	return left - minted
+}
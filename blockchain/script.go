@@ -0,0 +1,727 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/test-blockchain/wallet"
+)
+
+//Outputs are locked by a script and inputs unlock them with data pushed on
+//the stack before it runs. A script is a list of opcodes run on a stack of
+//byte strings, it succeeds when the stack ends with exactly one true item.
+//Pushing 0 to 75 bytes takes the opcode of the length followed by the bytes,
+//longer data uses OP_PUSHDATA1 or OP_PUSHDATA2 with a 1 or 2 bytes big endian
+//length. Numbers are unsigned big endian of at most 8 bytes, an item is false
+//when it is empty or all zeros.
+//
+//Outputs without a script are locked to their PubKeyHash with the
+//PayToPubKeyHash template, or with MultisigScript when the input holds a
+//multisig redeem script, and are unlocked by the Signature and PubKey, or the
+//Signatures, of the input
+
+type (
+	//scriptEnv is what a script checks besides its stack: input inIdx of tx
+	//spends prevOut, confirmed age blocks before the block spending it
+	scriptEnv struct {
+		tx      *Transaction
+		inIdx   int
+		prevOut TxOutput
+		age     int
+	}
+
+	scriptEngine struct {
+		env   *scriptEnv
+		stack [][]byte
+		steps int
+	}
+)
+
+const (
+	OP_0         = 0x00
+	OP_PUSHDATA1 = 0x4c
+	OP_PUSHDATA2 = 0x4d
+	OP_1         = 0x51
+	OP_16        = 0x60
+
+	OP_IF     = 0x63
+	OP_NOTIF  = 0x64
+	OP_ELSE   = 0x67
+	OP_ENDIF  = 0x68
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	OP_DROP = 0x75
+	OP_DUP  = 0x76
+	OP_SWAP = 0x7c
+
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	OP_NOT     = 0x91
+	OP_BOOLAND = 0x9a
+	OP_BOOLOR  = 0x9b
+
+	OP_SHA256  = 0xa8
+	OP_HASH160 = 0xa9
+
+	OP_CHECKSIG       = 0xac
+	OP_CHECKSIGVERIFY = 0xad
+	OP_CHECKMULTISIG  = 0xae
+
+	//OP_CHECKLOCKTIMEVERIFY pops a lock time and fails unless the lock time
+	//of the transaction is of the same kind, height or unix time, and not
+	//below it
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	//OP_CHECKSEQUENCEVERIFY pops a number of blocks and fails unless the
+	//output was confirmed at least that many blocks before the spending block
+	OP_CHECKSEQUENCEVERIFY = 0xb2
+
+	//MaxScriptSize is the longest locking or unlocking script
+	MaxScriptSize = 1000
+	//MaxScriptSteps is how many opcodes an input runs at most, a multisig
+	//check counts once per key
+	MaxScriptSteps = 200
+	//MaxStackItems is the deepest the stack gets
+	MaxStackItems = 100
+	//MaxPushSize is the longest item on the stack
+	MaxPushSize = 520
+)
+
+var (
+	ErrScriptFailed = errors.New("script does not succeed")
+
+	opNames = map[byte]string{
+		OP_0: "OP_0", OP_PUSHDATA1: "OP_PUSHDATA1", OP_PUSHDATA2: "OP_PUSHDATA2",
+		OP_IF: "OP_IF", OP_NOTIF: "OP_NOTIF", OP_ELSE: "OP_ELSE", OP_ENDIF: "OP_ENDIF",
+		OP_VERIFY: "OP_VERIFY", OP_RETURN: "OP_RETURN",
+		OP_DROP: "OP_DROP", OP_DUP: "OP_DUP", OP_SWAP: "OP_SWAP",
+		OP_EQUAL: "OP_EQUAL", OP_EQUALVERIFY: "OP_EQUALVERIFY",
+		OP_NOT: "OP_NOT", OP_BOOLAND: "OP_BOOLAND", OP_BOOLOR: "OP_BOOLOR",
+		OP_SHA256: "OP_SHA256", OP_HASH160: "OP_HASH160",
+		OP_CHECKSIG: "OP_CHECKSIG", OP_CHECKSIGVERIFY: "OP_CHECKSIGVERIFY", OP_CHECKMULTISIG: "OP_CHECKMULTISIG",
+		OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY", OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+	}
+)
+
+func scriptError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrScriptFailed, fmt.Sprintf(format, args...))
+}
+
+//appendPush adds the opcodes pushing data to script
+func appendPush(script, data []byte) []byte {
+	switch {
+	case len(data) < OP_PUSHDATA1:
+		script = append(script, byte(len(data)))
+	case len(data) <= 0xff:
+		script = append(script, OP_PUSHDATA1, byte(len(data)))
+	default:
+		var n [2]byte
+		binary.BigEndian.PutUint16(n[:], uint16(len(data)))
+		script = append(script, OP_PUSHDATA2, n[0], n[1])
+	}
+	return append(script, data...)
+}
+
+//appendNumber adds the opcodes pushing n to script, OP_1 to OP_16 for the
+//small ones
+func appendNumber(script []byte, n int64) []byte {
+	if n >= 1 && n <= 16 {
+		return append(script, byte(OP_1-1+n))
+	}
+	return appendPush(script, encodeNumber(n))
+}
+
+func encodeNumber(n int64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	return bytes.TrimLeft(buf[:], "\x00")
+}
+
+func decodeNumber(item []byte) (int64, error) {
+	if len(item) > 8 || (len(item) == 8 && item[0]&0x80 != 0) {
+		return 0, scriptError("number is out of range")
+	}
+
+	var buf [8]byte
+	copy(buf[8-len(item):], item)
+	return int64(binary.BigEndian.Uint64(buf[:])), nil
+}
+
+func isTrue(item []byte) bool {
+	for _, b := range item {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeBool(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+//readPush returns the data pushed by the push opcode at pc of script and the
+//position of the next opcode
+func readPush(script []byte, pc int) ([]byte, int, error) {
+	op := script[pc]
+	pc++
+
+	n := int(op)
+	switch op {
+	case OP_PUSHDATA1:
+		if pc+1 > len(script) {
+			return nil, 0, scriptError("push length is cut")
+		}
+		n = int(script[pc])
+		pc++
+	case OP_PUSHDATA2:
+		if pc+2 > len(script) {
+			return nil, 0, scriptError("push length is cut")
+		}
+		n = int(binary.BigEndian.Uint16(script[pc:]))
+		pc += 2
+	}
+
+	if n > MaxPushSize {
+		return nil, 0, scriptError("push of %d bytes", n)
+	}
+	if pc+n > len(script) {
+		return nil, 0, scriptError("push data is cut")
+	}
+
+	return script[pc : pc+n], pc + n, nil
+}
+
+func isPush(op byte) bool {
+	return op <= OP_PUSHDATA2
+}
+
+//checkScript tells whether script is well formed: short enough, with pushes
+//that fit in it
+func checkScript(script []byte) error {
+	if len(script) > MaxScriptSize {
+		return scriptError("script of %d bytes", len(script))
+	}
+
+	for pc := 0; pc < len(script); {
+		if !isPush(script[pc]) {
+			pc++
+			continue
+		}
+		_, next, err := readPush(script, pc)
+		if err != nil {
+			return err
+		}
+		pc = next
+	}
+
+	return nil
+}
+
+//isPushOnly tells whether script only pushes data and numbers, as unlocking
+//data must
+func isPushOnly(script []byte) bool {
+	for pc := 0; pc < len(script); {
+		if script[pc] >= OP_1 && script[pc] <= OP_16 {
+			pc++
+			continue
+		}
+		if !isPush(script[pc]) {
+			return false
+		}
+		_, next, err := readPush(script, pc)
+		if err != nil {
+			return false
+		}
+		pc = next
+	}
+	return true
+}
+
+//PayToPubKeyHash is the standard locking script of an address: the input
+//pushes a signature and the public key hashing to pubKeyHash
+func PayToPubKeyHash(pubKeyHash []byte) []byte {
+	script := []byte{OP_DUP, OP_HASH160}
+	script = appendPush(script, pubKeyHash)
+	return append(script, OP_EQUALVERIFY, OP_CHECKSIG)
+}
+
+//MultisigScript locks an output to m of keys: the input pushes one signature
+//slot per key, in the order of keys, empty for the keys that do not sign
+func MultisigScript(m int, keys [][]byte) []byte {
+	script := appendNumber(nil, int64(m))
+	for _, key := range keys {
+		script = appendPush(script, key)
+	}
+	script = appendNumber(script, int64(len(keys)))
+	return append(script, OP_CHECKMULTISIG)
+}
+
+//lockingScript is the script prevOut is locked with, for in
+func lockingScript(in *TxInput, prevOut TxOutput) ([]byte, error) {
+	if len(prevOut.Script) > 0 {
+		return prevOut.Script, nil
+	}
+	if !in.UsesKey(prevOut.PubKeyHash) {
+		return nil, scriptError("input key does not match the output")
+	}
+	if !in.IsMultisig() {
+		return PayToPubKeyHash(prevOut.PubKeyHash), nil
+	}
+
+	m, keys, err := wallet.ParseRedeemScript(in.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	return MultisigScript(m, keys), nil
+}
+
+//unlockingScript is the data in pushes before the locking script runs
+func unlockingScript(in *TxInput) ([]byte, error) {
+	if len(in.Unlock) > 0 {
+		if len(in.Signature) > 0 || in.IsMultisig() {
+			return nil, scriptError("input has both unlocking data and signatures")
+		}
+		return in.Unlock, nil
+	}
+
+	if !in.IsMultisig() {
+		return appendPush(appendPush(nil, in.Signature), in.PubKey), nil
+	}
+	if len(in.Signature) > 0 {
+		return nil, scriptError("multisig input has a single signature")
+	}
+
+	var script []byte
+	for _, signature := range in.Signatures {
+		script = appendPush(script, signature)
+	}
+	return script, nil
+}
+
+//verifyScript runs the unlocking data of the input of env and the locking
+//script of the output it spends
+func verifyScript(env *scriptEnv) error {
+	in := &env.tx.Inputs[env.inIdx]
+
+	unlock, err := unlockingScript(in)
+	if err != nil {
+		return err
+	}
+	lock, err := lockingScript(in, env.prevOut)
+	if err != nil {
+		return err
+	}
+	if !isPushOnly(unlock) {
+		return scriptError("unlocking data does not only push")
+	}
+
+	engine := &scriptEngine{env: env}
+	if err := engine.run(unlock); err != nil {
+		return err
+	}
+	if err := engine.run(lock); err != nil {
+		return err
+	}
+
+	if len(engine.stack) != 1 || !isTrue(engine.stack[0]) {
+		return scriptError("stack does not end with one true item")
+	}
+	return nil
+}
+
+func (e *scriptEngine) push(item []byte) error {
+	if len(e.stack) >= MaxStackItems {
+		return scriptError("stack is over %d items", MaxStackItems)
+	}
+	e.stack = append(e.stack, item)
+	return nil
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, scriptError("stack is empty")
+	}
+	item := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return item, nil
+}
+
+func (e *scriptEngine) popNumber() (int64, error) {
+	item, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNumber(item)
+}
+
+func (e *scriptEngine) step(n int) error {
+	e.steps += n
+	if e.steps > MaxScriptSteps {
+		return scriptError("over %d steps", MaxScriptSteps)
+	}
+	return nil
+}
+
+func (e *scriptEngine) run(script []byte) error {
+	if len(script) > MaxScriptSize {
+		return scriptError("script of %d bytes", len(script))
+	}
+
+	//branches holds whether every enclosing OP_IF runs its current branch
+	var branches []bool
+	running := func() bool {
+		for _, taken := range branches {
+			if !taken {
+				return false
+			}
+		}
+		return true
+	}
+
+	for pc := 0; pc < len(script); {
+		op := script[pc]
+		if err := e.step(1); err != nil {
+			return err
+		}
+
+		if isPush(op) {
+			data, next, err := readPush(script, pc)
+			if err != nil {
+				return err
+			}
+			pc = next
+			if running() {
+				if err := e.push(data); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		pc++
+
+		switch op {
+		case OP_IF, OP_NOTIF:
+			taken := false
+			if running() {
+				item, err := e.pop()
+				if err != nil {
+					return err
+				}
+				taken = isTrue(item) == (op == OP_IF)
+			}
+			branches = append(branches, taken)
+			continue
+		case OP_ELSE:
+			if len(branches) == 0 {
+				return scriptError("OP_ELSE without OP_IF")
+			}
+			branches[len(branches)-1] = !branches[len(branches)-1]
+			continue
+		case OP_ENDIF:
+			if len(branches) == 0 {
+				return scriptError("OP_ENDIF without OP_IF")
+			}
+			branches = branches[:len(branches)-1]
+			continue
+		}
+
+		if !running() {
+			continue
+		}
+		if err := e.execute(op); err != nil {
+			return err
+		}
+	}
+
+	if len(branches) > 0 {
+		return scriptError("OP_IF without OP_ENDIF")
+	}
+	return nil
+}
+
+//execute runs an opcode that is neither a push nor flow control
+func (e *scriptEngine) execute(op byte) error {
+	if op >= OP_1 && op <= OP_16 {
+		return e.push(encodeNumber(int64(op - OP_1 + 1)))
+	}
+
+	switch op {
+	case OP_VERIFY:
+		return e.verify()
+
+	case OP_RETURN:
+		return scriptError("OP_RETURN")
+
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+
+	case OP_DUP:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.stack = append(e.stack, item)
+		return e.push(item)
+
+	case OP_SWAP:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.stack = append(e.stack, a, b)
+		return nil
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if err := e.push(encodeBool(bytes.Equal(a, b))); err != nil {
+			return err
+		}
+		if op == OP_EQUALVERIFY {
+			return e.verify()
+		}
+		return nil
+
+	case OP_NOT:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.push(encodeBool(!isTrue(item)))
+
+	case OP_BOOLAND, OP_BOOLOR:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if op == OP_BOOLAND {
+			return e.push(encodeBool(isTrue(a) && isTrue(b)))
+		}
+		return e.push(encodeBool(isTrue(a) || isTrue(b)))
+
+	case OP_SHA256:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(item)
+		return e.push(hash[:])
+
+	case OP_HASH160:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.push(wallet.PublicKeyHash(item))
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if err := e.push(encodeBool(e.checkSig(pubKey, signature))); err != nil {
+			return err
+		}
+		if op == OP_CHECKSIGVERIFY {
+			return e.verify()
+		}
+		return nil
+
+	case OP_CHECKMULTISIG:
+		return e.checkMultisig()
+
+	case OP_CHECKLOCKTIMEVERIFY:
+		lockTime, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		txLockTime := e.env.tx.LockTime
+		if txLockTime == 0 || (txLockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold) || txLockTime < lockTime {
+			return scriptError("transaction is not locked until %d", lockTime)
+		}
+		return nil
+
+	case OP_CHECKSEQUENCEVERIFY:
+		blocks, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		if int64(e.env.age) < blocks {
+			return scriptError("output is %d blocks old, not %d", e.env.age, blocks)
+		}
+		return nil
+	}
+
+	return scriptError("unknown opcode %#x", op)
+}
+
+func (e *scriptEngine) verify() error {
+	item, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !isTrue(item) {
+		return scriptError("verify failed")
+	}
+	return nil
+}
+
+func (e *scriptEngine) checkSig(pubKey, signature []byte) bool {
+	if len(signature) == 0 {
+		return false
+	}
+	hash := e.env.tx.SigHash(e.env.inIdx, e.env.prevOut)
+	return wallet.Verify(pubKey, hash, signature)
+}
+
+//checkMultisig pops the number of keys, the keys, the number of signatures
+//needed and one signature slot per key. Every signature in the slots has to
+//be valid for the key of its slot
+func (e *scriptEngine) checkMultisig() error {
+	n, err := e.popNumber()
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > wallet.MaxMultisigKeys {
+		return scriptError("multisig of %d keys", n)
+	}
+	if err := e.step(int(n)); err != nil {
+		return err
+	}
+
+	keys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if keys[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+	m, err := e.popNumber()
+	if err != nil {
+		return err
+	}
+	if m < 1 || m > n {
+		return scriptError("multisig needs %d of %d signatures", m, n)
+	}
+	signatures := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if signatures[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	signed := int64(0)
+	for i, signature := range signatures {
+		if len(signature) == 0 {
+			continue
+		}
+		if !e.checkSig(keys[i], signature) {
+			return e.push(encodeBool(false))
+		}
+		signed++
+	}
+
+	return e.push(encodeBool(signed >= m))
+}
+
+//DisasmScript writes script as text: opcode names, OP_1 to OP_16 for small
+//numbers and 0x prefixed hex for pushed data
+func DisasmScript(script []byte) string {
+	var words []string
+
+	for pc := 0; pc < len(script); {
+		op := script[pc]
+		switch {
+		case isPush(op) && op != OP_0:
+			data, next, err := readPush(script, pc)
+			if err != nil {
+				return strings.Join(append(words, "[error]"), " ")
+			}
+			words = append(words, "0x"+hex.EncodeToString(data))
+			pc = next
+			continue
+		case op >= OP_1 && op <= OP_16:
+			words = append(words, fmt.Sprintf("OP_%d", op-OP_1+1))
+		case opNames[op] != "":
+			words = append(words, opNames[op])
+		default:
+			words = append(words, fmt.Sprintf("OP_UNKNOWN_%#x", op))
+		}
+		pc++
+	}
+
+	return strings.Join(words, " ")
+}
+
+//AssembleScript reads the text DisasmScript writes. Plain decimal words are
+//pushed as numbers
+func AssembleScript(text string) ([]byte, error) {
+	var script []byte
+
+	names := make(map[string]byte)
+	for op, name := range opNames {
+		names[name] = op
+	}
+
+	for _, word := range strings.Fields(text) {
+		if op, ok := names[word]; ok && op != OP_PUSHDATA1 && op != OP_PUSHDATA2 {
+			script = append(script, op)
+			continue
+		}
+
+		if strings.HasPrefix(word, "0x") {
+			data, err := hex.DecodeString(word[2:])
+			if err != nil {
+				return nil, fmt.Errorf("%s is not valid hex", word)
+			}
+			script = appendPush(script, data)
+			continue
+		}
+
+		if strings.HasPrefix(word, "OP_") {
+			n, err := strconv.Atoi(word[3:])
+			if err != nil || n < 1 || n > 16 {
+				return nil, fmt.Errorf("unknown opcode %s", word)
+			}
+			script = append(script, byte(OP_1-1+n))
+			continue
+		}
+
+		n, err := strconv.ParseInt(word, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s is neither an opcode, hex data nor a number", word)
+		}
+		script = appendNumber(script, n)
+	}
+
+	return script, checkScript(script)
+}
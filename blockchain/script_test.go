@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func mustAssemble(t *testing.T, text string) []byte {
+	t.Helper()
+
+	script, err := AssembleScript(text)
+	if err != nil {
+		t.Fatalf("%s: %s", text, err)
+	}
+	return script
+}
+
+func TestVerifyScript(t *testing.T) {
+	secret := []byte("secret")
+	hash := sha256.Sum256(secret)
+	hashLock := "OP_SHA256 0x" + hex.EncodeToString(hash[:]) + " OP_EQUAL"
+
+	cases := []struct {
+		name     string
+		unlock   string
+		lock     string
+		lockTime int64
+		age      int
+		ok       bool
+	}{
+		{"preimage", "0x" + hex.EncodeToString(secret), hashLock, 0, 0, true},
+		{"wrong preimage", "0x00", hashLock, 0, 0, false},
+		{"if", "OP_1", "OP_IF OP_1 OP_ELSE OP_0 OP_ENDIF", 0, 0, true},
+		{"else", "OP_0", "OP_IF OP_1 OP_ELSE OP_0 OP_ENDIF", 0, 0, false},
+		{"notif", "OP_0", "OP_NOTIF OP_1 OP_ENDIF", 0, 0, true},
+		{"no endif", "OP_1", "OP_IF OP_1", 0, 0, false},
+		{"boolor", "OP_1 OP_0", "OP_BOOLOR", 0, 0, true},
+		{"booland", "OP_1 OP_0", "OP_BOOLAND", 0, 0, false},
+		{"two items left", "OP_1 OP_1", "OP_DUP OP_DROP", 0, 0, false},
+		{"return", "OP_1", "OP_RETURN", 0, 0, false},
+		{"unlock not push only", "OP_1 OP_DUP", "OP_EQUAL", 0, 0, false},
+		{"lock time reached", "OP_1", "10 OP_CHECKLOCKTIMEVERIFY", 10, 0, true},
+		{"lock time not reached", "OP_1", "10 OP_CHECKLOCKTIMEVERIFY", 9, 0, false},
+		{"lock time of another kind", "OP_1", "10 OP_CHECKLOCKTIMEVERIFY", LockTimeThreshold + 10, 0, false},
+		{"old enough", "OP_1", "3 OP_CHECKSEQUENCEVERIFY", 0, 3, true},
+		{"too young", "OP_1", "3 OP_CHECKSEQUENCEVERIFY", 0, 2, false},
+		{"under the step limit", "OP_1", strings.Repeat("OP_DUP OP_DROP ", (MaxScriptSteps-1)/2), 0, 0, true},
+		{"over the step limit", "OP_1", strings.Repeat("OP_DUP OP_DROP ", MaxScriptSteps/2), 0, 0, false},
+	}
+	for _, c := range cases {
+		tx := &Transaction{nil, []TxInput{{Unlock: mustAssemble(t, c.unlock)}}, nil, c.lockTime}
+		env := &scriptEnv{tx, 0, TxOutput{Script: mustAssemble(t, c.lock)}, c.age}
+
+		err := verifyScript(env)
+		if c.ok && err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		} else if !c.ok && !errors.Is(err, ErrScriptFailed) {
+			t.Errorf("%s: got %v, want %v", c.name, err, ErrScriptFailed)
+		}
+	}
+}
+
+func TestAssembleScript(t *testing.T) {
+	script := PayToPubKeyHash(wallet.PublicKeyHash([]byte("key")))
+	text := DisasmScript(script)
+	if !strings.HasPrefix(text, "OP_DUP OP_HASH160 0x") || !strings.HasSuffix(text, "OP_EQUALVERIFY OP_CHECKSIG") {
+		t.Fatalf("pay to pubkey hash written as %s", text)
+	}
+	if again := mustAssemble(t, text); !bytes.Equal(again, script) {
+		t.Fatalf("%s assembled to %x, want %x", text, again, script)
+	}
+
+	for _, text := range []string{"OP_NOPE", "0xzz", "OP_17", "-1"} {
+		if _, err := AssembleScript(text); err == nil {
+			t.Errorf("%s assembled", text)
+		}
+	}
+}
+
+func TestSpendScriptOutput(t *testing.T) {
+	chain, a := newTestChain(t)
+	c, forger := newTestWallet(t), newTestWallet(t)
+
+	//c can spend it with the secret and a signature
+	secret := []byte("secret")
+	hash := sha256.Sum256(secret)
+	lock := mustAssemble(t, "OP_SHA256 0x"+hex.EncodeToString(hash[:])+" OP_EQUALVERIFY 0x"+hex.EncodeToString(c.Publickey)+" OP_CHECKSIG")
+
+	locked, err := NewScriptTransaction(a, string(a.Address()), lock, 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := addTestBlock(t, chain, tipBlock(t, chain), forger, 1, locked)
+
+	spend := func(preimage []byte) *Transaction {
+		tx, err := SpendScriptOutput(chain, locked.ID, 0, string(c.Address()), 1, 0, func(sigHash []byte) ([]byte, error) {
+			signature, err := wallet.Sign(&c.PrivateKey, sigHash)
+			if err != nil {
+				return nil, err
+			}
+			return appendPush(appendPush(nil, signature), preimage), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	if err := chain.VerifyTransaction(spend([]byte("guess"))); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("wrong secret: got %v, want %v", err, ErrBadSignature)
+	}
+	tx := spend(secret)
+	if err := chain.VerifyTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	addTestBlock(t, chain, parent, forger, 1, tx)
+	if got := balance(t, chain, c); got != 9 {
+		t.Fatalf("balance of c is %d, want 9", got)
+	}
+}
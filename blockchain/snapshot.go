@@ -0,0 +1,400 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type (
+	//Snapshot is the UTXO set of the main chain at Height. A node can start
+	//from it and only sync the blocks after Height
+	Snapshot struct {
+		Height    int
+		BlockHash []byte
+		//Hash commits to Height, BlockHash, the genesis block and UTXOs
+		Hash    []byte
+		Genesis *Block
+		//Block is the block at Height, the parent of the next block to sync
+		Block *Block
+		//Config is the genesis file of the chain as JSON, empty when the chain
+		//was not made from one
+		Config []byte
+		UTXOs  []SnapshotEntry
+	}
+
+	//SnapshotEntry holds the unspent outputs of one transaction and the
+	//height it was confirmed at
+	SnapshotEntry struct {
+		TxID    []byte
+		Outputs TxOutputs
+	}
+)
+
+var (
+	//base holds the height of the snapshot the chain started from
+	baseKey = []byte("base")
+
+	ErrBadSnapshot = errors.New("snapshot is not valid")
+)
+
+func getBase(txn StoreTxn) (int, error) {
+	v, err := txn.Get(baseKey)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if len(v) != 8 {
+		return 0, fmt.Errorf("%w: base height", ErrBadEncoding)
+	}
+	return int(binary.BigEndian.Uint64(v)), nil
+}
+
+func (e *encoder) writeSnapshotEntries(entries []SnapshotEntry) {
+	e.writeLen(len(entries))
+	for _, entry := range entries {
+		e.writeBytes(entry.TxID)
+		if e.version >= 2 {
+			e.writeInt(int64(entry.Outputs.Height))
+		}
+		if e.version >= 5 {
+			e.writeBool(entry.Outputs.Coinbase)
+		}
+		e.writeLen(len(entry.Outputs.Outputs))
+		for i := range entry.Outputs.Outputs {
+			e.writeInt(int64(entry.Outputs.Indexes[i]))
+			e.writeOutput(&entry.Outputs.Outputs[i])
+		}
+	}
+}
+
+func (d *decoder) readSnapshotEntries() []SnapshotEntry {
+	var entries []SnapshotEntry
+
+	for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+		var entry SnapshotEntry
+		entry.TxID = d.readBytes()
+		if d.version >= 2 {
+			entry.Outputs.Height = int(d.readInt())
+		}
+		if d.version >= 5 {
+			entry.Outputs.Coinbase = d.readBool()
+		}
+		for j, m := 0, d.readLen(); j < m && d.err == nil; j++ {
+			entry.Outputs.Indexes = append(entry.Outputs.Indexes, int(d.readInt()))
+			entry.Outputs.Outputs = append(entry.Outputs.Outputs, d.readOutput())
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+//ContentHash is the hash of the height, the block hash, the genesis hash and
+//the UTXO set of the snapshot
+func (s *Snapshot) ContentHash() []byte {
+	hash := sha256.Sum256(hashData(func(e *encoder) {
+		e.writeInt(int64(s.Height))
+		e.writeBytes(s.BlockHash)
+		e.writeBytes(s.Genesis.Hash)
+		e.writeSnapshotEntries(s.UTXOs)
+	}))
+	return hash[:]
+}
+
+func (s *Snapshot) Serialize() []byte {
+	return serialize(func(e *encoder) {
+		e.writeInt(int64(s.Height))
+		e.writeBytes(s.BlockHash)
+		e.writeBytes(s.Hash)
+		e.writeBlock(s.Genesis)
+		e.writeBlock(s.Block)
+		e.writeBytes(s.Config)
+		e.writeSnapshotEntries(s.UTXOs)
+	})
+}
+
+func DeserializeSnapshot(data []byte) (*Snapshot, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	s.Height = int(d.readInt())
+	s.BlockHash = d.readBytes()
+	s.Hash = d.readBytes()
+	genesis := d.readBlock()
+	s.Genesis = &genesis
+	block := d.readBlock()
+	s.Block = &block
+	s.Config = d.readBytes()
+	s.UTXOs = d.readSnapshotEntries()
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	//older snapshots cannot tell coinbase outputs, which have to mature
+	if d.version < 5 {
+		return nil, fmt.Errorf("%w: version %d has no coinbase flags", ErrBadSnapshot, d.version)
+	}
+
+	return &s, nil
+}
+
+//Verify checks that the blocks of the snapshot are consistent and that Hash
+//matches its contents. It cannot tell whether the UTXO set is the one of the
+//chain, compare Hash with one from a node you trust for that
+func (s *Snapshot) Verify() error {
+	if err := ValidateGenesis(s.Genesis); err != nil {
+		return err
+	}
+
+	if len(s.Config) == 0 {
+		return fmt.Errorf("%w: %s", ErrBadSnapshot, ErrNoGenesisConfig)
+	}
+	config, err := ParseGenesisConfig(s.Config)
+	if err != nil {
+		return err
+	}
+	if err := config.checkGenesis(s.Genesis); err != nil {
+		return fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+	}
+
+	block := s.Block
+	if block.Height != s.Height || !bytes.Equal(block.Hash, s.BlockHash) {
+		return fmt.Errorf("%w: block %x is not at height %d", ErrBadSnapshot, block.Hash, s.Height)
+	}
+	if s.Height == 0 && !bytes.Equal(block.Hash, s.Genesis.Hash) {
+		return fmt.Errorf("%w: block at height 0 is not the genesis block", ErrBadSnapshot)
+	}
+	if block.Version != BlockVersion {
+		return ruleError(ErrBadVersion, "%d", block.Version)
+	}
+	if block.ChainID != s.Genesis.ChainID {
+		return ruleError(ErrBadChainID, "%s", block.ChainID)
+	}
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ruleError(ErrBadMerkleRoot, "%x", block.Hash)
+	}
+	if !bytes.Equal(block.Hash, block.BlockHashing()) {
+		return ruleError(ErrBadBlockHash, "%x", block.Hash)
+	}
+
+	for _, entry := range s.UTXOs {
+		if len(entry.Outputs.Outputs) == 0 {
+			return fmt.Errorf("%w: no outputs for %x", ErrBadSnapshot, entry.TxID)
+		}
+	}
+
+	if !bytes.Equal(s.Hash, s.ContentHash()) {
+		return fmt.Errorf("%w: hash does not match the contents", ErrBadSnapshot)
+	}
+
+	return nil
+}
+
+//Snapshot takes the UTXO set at height, or at the tip when height is
+//negative, by undoing the blocks above it on the current UTXO index
+func (chain *Blockchain) Snapshot(height int) (*Snapshot, error) {
+	if height < 0 {
+		var err error
+		if height, err = chain.GetLastHeight(); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Snapshot{Height: height}
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		hash, err := txn.Get(heightKey(height))
+		if err == ErrKeyNotFound || height < chain.Base {
+			return ErrBlockNotFound
+		} else if err != nil {
+			return err
+		}
+		s.BlockHash = hash
+
+		if s.Block, err = getBlock(txn, hash); err != nil {
+			return err
+		}
+
+		genesisHash, err := txn.Get(heightKey(0))
+		if err != nil {
+			return err
+		}
+		if s.Genesis, err = getBlock(txn, genesisHash); err != nil {
+			return err
+		}
+
+		if s.Config, err = txn.Get(genesisKey); err != nil && err != ErrKeyNotFound {
+			return err
+		}
+
+		utxos := make(map[string]map[int]TxOutput)
+		heights := make(map[string]int)
+		coinbases := make(map[string]bool)
+		iterErr := txn.Iterate(utxoPrefix, func(key, value []byte) bool {
+			var outs TxOutputs
+			if outs, err = DeserializeOutputs(value); err != nil {
+				return false
+			}
+			byIndex := make(map[int]TxOutput)
+			for i, out := range outs.Outputs {
+				byIndex[outs.Indexes[i]] = out
+			}
+			id := hex.EncodeToString(key[len(utxoPrefix):])
+			utxos[id] = byIndex
+			heights[id] = outs.Height
+			coinbases[id] = outs.Coinbase
+			return true
+		})
+		if iterErr != nil {
+			return iterErr
+		}
+		if err != nil {
+			return err
+		}
+
+		//undo the blocks above height: drop what they created and put back
+		//what they spent
+		tip, err := getTip(txn)
+		if err != nil {
+			return err
+		}
+		for cur := tip; !bytes.Equal(cur, hash); {
+			block, err := getBlock(txn, cur)
+			if err != nil {
+				return err
+			}
+			undoData, err := txn.Get(undoKey(cur))
+			if err != nil {
+				return err
+			}
+			undo, err := DeserializeUndo(undoData)
+			if err != nil {
+				return err
+			}
+
+			created := make(map[string]bool)
+			for _, tx := range block.Transaction {
+				id := hex.EncodeToString(tx.ID)
+				created[id] = true
+				delete(utxos, id)
+			}
+			for _, spent := range undo.Spent {
+				id := hex.EncodeToString(spent.TxID)
+				if created[id] {
+					continue
+				}
+				if utxos[id] == nil {
+					utxos[id] = make(map[int]TxOutput)
+				}
+				utxos[id][spent.Index] = spent.Output
+				heights[id] = spent.Height
+				coinbases[id] = spent.Coinbase
+			}
+
+			cur = block.PrevHash
+		}
+
+		for id, byIndex := range utxos {
+			entry := SnapshotEntry{Outputs: TxOutputs{Height: heights[id], Coinbase: coinbases[id]}}
+			if entry.TxID, err = hex.DecodeString(id); err != nil {
+				return err
+			}
+
+			var indexes []int
+			for idx := range byIndex {
+				indexes = append(indexes, idx)
+			}
+			sort.Ints(indexes)
+			for _, idx := range indexes {
+				entry.Outputs.Outputs = append(entry.Outputs.Outputs, byIndex[idx])
+				entry.Outputs.Indexes = append(entry.Outputs.Indexes, idx)
+			}
+			s.UTXOs = append(s.UTXOs, entry)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(s.UTXOs, func(i, j int) bool {
+		return bytes.Compare(s.UTXOs[i].TxID, s.UTXOs[j].TxID) < 0
+	})
+	s.Hash = s.ContentHash()
+
+	return s, nil
+}
+
+//InitBlockchainFromSnapshot creates the chain of nodeID from a snapshot
+func InitBlockchainFromSnapshot(nodeID string, s *Snapshot) (*Blockchain, error) {
+	return initBlockchain(nodeID, func(store ChainStore) (*Blockchain, error) {
+		return CreateBlockchainFromSnapshot(store, s)
+	})
+}
+
+//CreateBlockchainFromSnapshot writes the genesis block, the block at the
+//snapshot height and the UTXO set of s into an empty store. The chain then
+//continues from the block at the snapshot height
+func CreateBlockchainFromSnapshot(store ChainStore, s *Snapshot) (*Blockchain, error) {
+	if err := s.Verify(); err != nil {
+		return nil, err
+	}
+
+	batch := store.NewBatch()
+	for _, entry := range s.UTXOs {
+		outs, err := entry.Outputs.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		if err := batch.Set(utxoKey(entry.TxID), outs); err != nil {
+			return nil, err
+		}
+		for _, out := range entry.Outputs.Outputs {
+			if err := batch.Set(utxoAddrKey(out.PubKeyHash, entry.TxID), []byte{}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := batch.Flush(); err != nil {
+		return nil, err
+	}
+
+	err := store.Update(func(txn StoreTxn) error {
+		for _, block := range []*Block{s.Genesis, s.Block} {
+			if err := putBlock(txn, block); err != nil {
+				return err
+			}
+			if err := txn.Set(heightKey(block.Height), block.Hash); err != nil {
+				return err
+			}
+		}
+
+		if len(s.Config) > 0 {
+			if err := txn.Set(genesisKey, s.Config); err != nil {
+				return err
+			}
+		}
+
+		if err := txn.Set(baseKey, ToHex(int64(s.Height))); err != nil {
+			return err
+		}
+
+		return setTip(txn, s.BlockHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadBlockchain(store)
+}
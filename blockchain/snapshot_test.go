@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestSnapshotSync(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, c, forger := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 20, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := addTestBlock(t, chain, tipBlock(t, chain), forger, 1, toB)
+	toC := spendOutput(t, b, toB, 0, c, 5, 1)
+	m2 := addTestBlock(t, chain, m1, forger, 1, toC)
+
+	balances := func(chain *Blockchain) [4]int {
+		return [4]int{balance(t, chain, a), balance(t, chain, b), balance(t, chain, c), balance(t, chain, forger)}
+	}
+	atM2 := balances(chain)
+
+	//a block above the snapshot height, spending what m2 created
+	toA := spendOutput(t, c, toC, 0, a, 3, 1)
+	m3 := newTestBlock(t, m2, forger, chain.Config.BlockSubsidy(3)+1, toA)
+	if err := chain.AddBlock(m3); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := chain.Snapshot(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DeserializeSnapshot(s.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Hash, s.Hash) || !bytes.Equal(decoded.ContentHash(), s.Hash) {
+		t.Fatal("snapshot changed through its encoding")
+	}
+
+	synced, err := CreateBlockchainFromSnapshot(NewMemoryStore(), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced.Base != 2 || !bytes.Equal(synced.LastHash, m2.Hash) {
+		t.Fatalf("synced chain starts at %d on %x, want 2 on %x", synced.Base, synced.LastHash, m2.Hash)
+	}
+	if got := balances(synced); got != atM2 {
+		t.Fatalf("balances from the snapshot %v, want %v", got, atM2)
+	}
+
+	if err := synced.AddBlock(m3); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := balances(synced), balances(chain); got != want {
+		t.Fatalf("balances after syncing the next block %v, want %v", got, want)
+	}
+	if _, err := synced.FindUTXO(); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("rebuilding the UTXO set without history: got %v, want %v", err, ErrNoHistory)
+	}
+
+	config := decoded.Config
+	decoded.Config = nil
+	if err := decoded.Verify(); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("snapshot without its genesis file: got %v, want %v", err, ErrBadSnapshot)
+	}
+	other := *chain.Config
+	other.Params.BlockReward++
+	if decoded.Config, err = other.Serialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("snapshot with another genesis file: got %v, want %v", err, ErrBadSnapshot)
+	}
+	decoded.Config = config
+
+	decoded.UTXOs[0].Outputs.Outputs[0].Value++
+	if err := decoded.Verify(); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("tampered snapshot: got %v, want %v", err, ErrBadSnapshot)
+	}
+	if _, err := CreateBlockchainFromSnapshot(NewMemoryStore(), decoded); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("chain from a tampered snapshot: got %v, want %v", err, ErrBadSnapshot)
+	}
+}
+
+func TestSnapshotCoinbaseMaturity(t *testing.T) {
+	chain, a := newTestChain(t)
+	forger, other := newTestWallet(t), newTestWallet(t)
+
+	m1 := addTestBlock(t, chain, tipBlock(t, chain), forger, 0)
+	m2 := addTestBlock(t, chain, m1, other, 0)
+
+	s, err := chain.Snapshot(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DeserializeSnapshot(s.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced, err := CreateBlockchainFromSnapshot(NewMemoryStore(), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the coinbase of m1 is below the base of synced, only its UTXO entry
+	//tells it has not matured
+	spend := spendOutput(t, forger, m1.Transaction[0], 0, a, 5, 0)
+	early := newTestBlock(t, m2, other, chain.Config.BlockSubsidy(3), spend)
+	for name, c := range map[string]*Blockchain{"full": chain, "synced": synced} {
+		if err := c.AddBlock(early); !errors.Is(err, ErrImmatureSpend) {
+			t.Fatalf("%s chain spending an immature coinbase: got %v, want %v", name, err, ErrImmatureSpend)
+		}
+		if amount, _, err := (UTXOSet{c}).FindSpendableOutputs(wallet.PublicKeyHash(forger.Publickey), 1); err != nil || amount != 0 {
+			t.Fatalf("%s chain found %d spendable in an immature coinbase (%v)", name, amount, err)
+		}
+	}
+
+	parent := m2
+	for parent.Height+1 < m1.Height+chain.Config.Params.CoinbaseMaturity {
+		parent = addTestBlock(t, chain, parent, other, 0)
+		if err := synced.AddBlock(parent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	block := newTestBlock(t, parent, other, chain.Config.BlockSubsidy(parent.Height+1), spend)
+	for name, c := range map[string]*Blockchain{"full": chain, "synced": synced} {
+		if err := c.AddBlock(block); err != nil {
+			t.Fatalf("%s chain spending a matured coinbase: %s", name, err)
+		}
+	}
+}
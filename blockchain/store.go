@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+	"errors"
+)
+
+type (
+	//StoreTxn reads and writes keys inside ChainStore.View and ChainStore.Update.
+	//Writes made in an Update are only visible to others once it returns nil
+	StoreTxn interface {
+		Get(key []byte) ([]byte, error)
+		Set(key, value []byte) error
+		Delete(key []byte) error
+		//Iterate calls fn for every key starting with prefix in key order
+		//until fn returns false
+		Iterate(prefix []byte, fn func(key, value []byte) bool) error
+		//IterateReverse is Iterate in reverse key order, starting below before
+		//when it is set
+		IterateReverse(prefix, before []byte, fn func(key, value []byte) bool) error
+	}
+
+	//Batch groups many writes that do not need to be atomic, like rebuilding
+	//an index, and commits them in as many steps as the store needs
+	Batch interface {
+		Set(key, value []byte) error
+		Delete(key []byte) error
+		Flush() error
+	}
+
+	//ChainStore is where a Blockchain keeps its blocks, its tip and its indexes
+	ChainStore interface {
+		GetBlock(hash []byte) (*Block, error)
+		PutBlock(block *Block) error
+		GetTip() ([]byte, error)
+		SetTip(hash []byte) error
+
+		View(fn func(txn StoreTxn) error) error
+		Update(fn func(txn StoreTxn) error) error
+		NewBatch() Batch
+		//CollectGarbage gives back the space of deleted keys
+		CollectGarbage() error
+		Close() error
+	}
+)
+
+var (
+	ErrKeyNotFound = errors.New("Key not found")
+	ErrReadOnlyTxn = errors.New("No sets or deletes are allowed in a read-only transaction")
+
+	//lh holds the hash of the tip of the main chain
+	tipKey = []byte("lh")
+)
+
+func getBlock(txn StoreTxn, hash []byte) (*Block, error) {
+	blockData, err := txn.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return Deserialize(blockData)
+}
+
+func putBlock(txn StoreTxn, block *Block) error {
+	if err := putHeader(txn, block.Hash, &block.BlockHeader); err != nil {
+		return err
+	}
+	return txn.Set(block.Hash, block.Serialize())
+}
+
+func getTip(txn StoreTxn) ([]byte, error) {
+	return txn.Get(tipKey)
+}
+
+func setTip(txn StoreTxn, hash []byte) error {
+	return txn.Set(tipKey, hash)
+}
+
+//prefixEnd is the first key above every key starting with prefix, nil when
+//there is none
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func hasKey(txn StoreTxn, key []byte) bool {
+	_, err := txn.Get(key)
+	return err == nil
+}
+
+//storeGetBlock and the functions below give every ChainStore the same block
+//and tip accessors on top of its View and Update
+func storeGetBlock(store ChainStore, hash []byte) (*Block, error) {
+	var block *Block
+
+	err := store.View(func(txn StoreTxn) error {
+		var err error
+		block, err = getBlock(txn, hash)
+		return err
+	})
+
+	return block, err
+}
+
+func storePutBlock(store ChainStore, block *Block) error {
+	return store.Update(func(txn StoreTxn) error {
+		return putBlock(txn, block)
+	})
+}
+
+func storeGetTip(store ChainStore) ([]byte, error) {
+	var tip []byte
+
+	err := store.View(func(txn StoreTxn) error {
+		var err error
+		tip, err = getTip(txn)
+		return err
+	})
+
+	return tip, err
+}
+
+func storeSetTip(store ChainStore, hash []byte) error {
+	return store.Update(func(txn StoreTxn) error {
+		return setTip(txn, hash)
+	})
+}
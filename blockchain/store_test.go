@@ -0,0 +1,250 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//storeKeys returns the keys starting with prefix that txn sees, in order
+func storeKeys(t *testing.T, txn StoreTxn, prefix string) string {
+	t.Helper()
+
+	var keys []string
+	err := txn.Iterate([]byte(prefix), func(key, value []byte) bool {
+		if !bytes.Equal(key, value) {
+			t.Errorf("key %q holds %q", key, value)
+		}
+		keys = append(keys, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(keys, " ")
+}
+
+func testStore(t *testing.T, store ChainStore) {
+	t.Helper()
+
+	set := func(txn StoreTxn, keys ...string) error {
+		for _, key := range keys {
+			if err := txn.Set([]byte(key), []byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := store.Update(func(txn StoreTxn) error {
+		return set(txn, "a", "p-1", "p-3", "q")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+	if err := store.Update(func(txn StoreTxn) error {
+		if err := set(txn, "p-5"); err != nil {
+			return err
+		}
+		return failed
+	}); err != failed {
+		t.Fatalf("failing update: got %v, want %v", err, failed)
+	}
+
+	err := store.Update(func(txn StoreTxn) error {
+		if err := set(txn, "p-2", "p-4"); err != nil {
+			return err
+		}
+		if err := txn.Delete([]byte("p-3")); err != nil {
+			return err
+		}
+		if _, err := txn.Get([]byte("p-3")); err != ErrKeyNotFound {
+			t.Errorf("key deleted in the update: got %v, want %v", err, ErrKeyNotFound)
+		}
+		if got := storeKeys(t, txn, "p-"); got != "p-1 p-2 p-4" {
+			t.Errorf("update sees %q, want its own writes", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.View(func(txn StoreTxn) error {
+		if got := storeKeys(t, txn, "p"); got != "p-1 p-2 p-4" {
+			t.Errorf("view sees %q, want the committed keys only", got)
+		}
+		if _, err := txn.Get([]byte("p-5")); err != ErrKeyNotFound {
+			t.Errorf("key of a failed update: got %v, want %v", err, ErrKeyNotFound)
+		}
+		if err := txn.Set([]byte("v"), nil); err == nil {
+			t.Error("set in a view succeeded")
+		}
+
+		first := ""
+		if err := txn.Iterate([]byte("p-"), func(key, value []byte) bool {
+			first += string(key)
+			return false
+		}); err != nil {
+			return err
+		}
+		if first != "p-1" {
+			t.Errorf("iteration stopped after %q, want p-1", first)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := store.NewBatch()
+	for _, key := range []string{"b-1", "b-2"} {
+		if err := batch.Set([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	err = store.View(func(txn StoreTxn) error {
+		if got := storeKeys(t, txn, ""); !strings.HasPrefix(got, "b-1 b-2 p-1") {
+			t.Errorf("after the batch the store has %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetTip(); err != ErrKeyNotFound {
+		t.Fatalf("tip of an empty chain: got %v, want %v", err, ErrKeyNotFound)
+	}
+	if err := store.SetTip([]byte("tip")); err != nil {
+		t.Fatal(err)
+	}
+	if tip, err := store.GetTip(); err != nil || string(tip) != "tip" {
+		t.Fatalf("tip is %q (%v)", tip, err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testStore(t, NewMemoryStore())
+	})
+	t.Run("badger", func(t *testing.T) {
+		store, err := NewBadgerStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		testStore(t, store)
+	})
+}
+
+func TestStoreChainParity(t *testing.T) {
+	badgerStore, err := NewBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer badgerStore.Close()
+
+	a, forger := newTestWallet(t), newTestWallet(t)
+	memory, err := CreateBlockchain(NewMemoryStore(), string(a.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onBadger, err := CreateBlockchain(badgerStore, string(a.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := tipBlock(t, memory)
+	for i := 0; i < 3; i++ {
+		block := newTestBlock(t, parent, forger, memory.Config.BlockSubsidy(parent.Height+1))
+		for _, chain := range []*Blockchain{memory, onBadger} {
+			if err := chain.AddBlock(block); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parent = block
+	}
+
+	reopened, err := LoadBlockchain(badgerStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reopened.LastHash, memory.LastHash) {
+		t.Fatalf("badger tip %x, memory tip %x", reopened.LastHash, memory.LastHash)
+	}
+	if !reflect.DeepEqual(utxoIndex(t, onBadger), utxoIndex(t, memory)) {
+		t.Fatal("UTXO index differs between badger and memory")
+	}
+}
+
+func testIterateReverse(t *testing.T, store ChainStore) {
+	t.Helper()
+
+	err := store.Update(func(txn StoreTxn) error {
+		for _, key := range []string{"a", "p-1", "p-2", "p-3", "p\xff", "q"} {
+			if err := txn.Set([]byte(key), []byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		prefix, before string
+		want           string
+	}{
+		{"p", "", "p\xff p-3 p-2 p-1"},
+		{"p-", "", "p-3 p-2 p-1"},
+		{"p-", "p-3", "p-2 p-1"},
+		{"p-", "p-2x", "p-2 p-1"},
+		{"p-", "p-1", ""},
+		{"\xff", "", ""},
+	}
+	for _, c := range cases {
+		var before []byte
+		if c.before != "" {
+			before = []byte(c.before)
+		}
+
+		var keys []string
+		err := store.View(func(txn StoreTxn) error {
+			return txn.IterateReverse([]byte(c.prefix), before, func(key, value []byte) bool {
+				keys = append(keys, string(key))
+				return true
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(keys, " "); got != c.want {
+			t.Errorf("prefix %q before %q: got %q, want %q", c.prefix, c.before, got, c.want)
+		}
+	}
+}
+
+func TestIterateReverse(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testIterateReverse(t, NewMemoryStore())
+	})
+	t.Run("badger", func(t *testing.T) {
+		store, err := NewBadgerStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		testIterateReverse(t, store)
+	})
+}
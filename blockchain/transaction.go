@@ -2,16 +2,12 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/test-blockchain/wallet"
@@ -22,180 +18,607 @@ type (
 		ID      []byte
 		Inputs  []TxInput
 		Outputs []TxOutput
+		//LockTime is the first block height, or unix time when it is at least
+		//LockTimeThreshold, the transaction can be forged at. 0 does not lock it
+		LockTime int64
 	}
 )
 
+const (
+	//LockTimeThreshold separates lock times given as heights from the ones
+	//given as unix times, as in bitcoin
+	LockTimeThreshold = 500000000
+)
+
 //CoinbaseTx is reward function
-func CoinbaseTx(to, data string, value int) *Transaction {
+func CoinbaseTx(to, data string, value int) (*Transaction, error) {
 	if data == "" {
 		randData := make([]byte, 24)
 		_, err := rand.Read(randData)
-		Handler(err)
+		if err != nil {
+			return nil, err
+		}
 
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txin := TxInput{[]byte{}, "", -1, nil, []byte(data)}
-	txout := NewTxOutput(value, to)
+	txin := TxInput{[]byte{}, "", -1, nil, []byte(data), nil, nil}
+	txout, err := NewTxOutput(value, to)
+	if err != nil {
+		return nil, err
+	}
 
-	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}}
+	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}, 0}
 	tx.ID = tx.Hash()
 
-	return &tx
+	return &tx, nil
 }
 
-func NewTransaction(w *wallet.Wallet, Sender, Receiver string, amount int, chain *Blockchain) *Transaction {
-	var (
-		inputs  []TxInput
-		outputs []TxOutput
-	)
+//NewTransaction pays amount to Receiver from the outputs of w and leaves fee
+//to the forger of the block that confirms it. The rest comes back as change
+func NewTransaction(w *wallet.Wallet, Sender, Receiver string, amount, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	return NewLockedTransaction(w, Sender, Receiver, amount, fee, 0, 0, UTXO)
+}
 
-	pubKeyHash := wallet.PublicKeyHash(w.Publickey)
-	acc, validOutputs := chain.FindSpendableOutputs(pubKeyHash, amount)
+//NewLockedTransaction is NewTransaction for a transaction that cannot be
+//forged before lockTime, paying an output that cannot be spent until
+//lockBlocks blocks after it is confirmed
+func NewLockedTransaction(w *wallet.Wallet, Sender, Receiver string, amount, fee int, lockTime int64, lockBlocks int, UTXO *UTXOSet) (*Transaction, error) {
+	output, err := NewTxOutput(amount, Receiver)
+	if err != nil {
+		return nil, err
+	}
+	output.LockBlocks = lockBlocks
+
+	return signedTransaction(w, Sender, []TxOutput{*output}, fee, lockTime, UTXO)
+}
+
+//NewScriptTransaction is NewTransaction paying amount to an output locked
+//by script
+func NewScriptTransaction(w *wallet.Wallet, Sender string, script []byte, amount, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	output, err := NewScriptOutput(amount, script)
+	if err != nil {
+		return nil, err
+	}
+
+	return signedTransaction(w, Sender, []TxOutput{*output}, fee, 0, UTXO)
+}
+
+//NewDataTransaction anchors data in a data output of a transaction from w.
+//Receiver is paid amount too unless it is empty, only the fee is spent then
+func NewDataTransaction(w *wallet.Wallet, Sender, Receiver string, amount int, data []byte, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	var outputs []TxOutput
+
+	if Receiver != "" {
+		output, err := NewTxOutput(amount, Receiver)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *output)
+	}
+
+	output, err := NewDataOutput(data)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, *output)
+
+	return signedTransaction(w, Sender, outputs, fee, 0, UTXO)
+}
+
+//SpendScriptOutput builds a transaction paying output out of txID, locked by
+//a script, to Receiver less fee. unlock makes the unlocking data of the input
+//from the hash it has to sign
+func SpendScriptOutput(chain *Blockchain, txID []byte, out int, Receiver string, fee int, lockTime int64, unlock func(sigHash []byte) ([]byte, error)) (*Transaction, error) {
+	in := TxInput{txID, "", out, nil, nil, nil, nil}
+	prevTx, err := chain.prevTransaction(in)
+	if err != nil {
+		return nil, err
+	}
+	prevOut, ok := prevOutput(in, map[string]Transaction{hex.EncodeToString(txID): prevTx})
+	if !ok || len(prevOut.Script) == 0 {
+		return nil, fmt.Errorf("%x:%d is not an output locked by a script", txID, out)
+	}
+	if fee < 0 || fee > prevOut.Value || lockTime < 0 {
+		return nil, fmt.Errorf("fee has to be between 0 and %d", prevOut.Value)
+	}
+
+	output, err := NewTxOutput(prevOut.Value-fee, Receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := Transaction{nil, []TxInput{in}, []TxOutput{*output}, lockTime}
+	if tx.Inputs[0].Unlock, err = unlock(tx.SigHash(0, prevOut)); err != nil {
+		return nil, err
+	}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
+
+//signedTransaction pays outputs from the outputs of w and signs it
+func signedTransaction(w *wallet.Wallet, Sender string, outputs []TxOutput, fee int, lockTime int64, UTXO *UTXOSet) (*Transaction, error) {
+	from := fmt.Sprintf("%s", w.Address())
+	newInput := func(txID []byte, out int) TxInput {
+		return TxInput{txID, Sender, out, nil, w.Publickey, nil, nil}
+	}
+
+	tx, err := unsignedTransaction(from, wallet.PublicKeyHash(w.Publickey), newInput, outputs, fee, lockTime, UTXO)
+	if err != nil {
+		return nil, err
+	}
+	if err := UTXO.Blockchain.SignTransaction(tx, w.PrivateKey); err != nil {
+		return nil, err
+	}
+	tx.ID = tx.Hash()
+
+	return tx, nil
+}
+
+//NewMultisigTransaction is NewLockedTransaction from the multisig address of
+//redeemScript. The transaction is not signed, every co-signer adds a
+//signature with SignTransaction until it has as many as the script needs
+func NewMultisigTransaction(redeemScript []byte, Receiver string, amount, fee int, lockTime int64, lockBlocks int, UTXO *UTXOSet) (*Transaction, error) {
+	_, keys, err := wallet.ParseRedeemScript(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	from := string(wallet.MultisigAddress(redeemScript))
+	newInput := func(txID []byte, out int) TxInput {
+		return TxInput{txID, from, out, nil, redeemScript, make([][]byte, len(keys)), nil}
+	}
+
+	output, err := NewTxOutput(amount, Receiver)
+	if err != nil {
+		return nil, err
+	}
+	output.LockBlocks = lockBlocks
+
+	tx, err := unsignedTransaction(from, wallet.PublicKeyHash(redeemScript), newInput, []TxOutput{*output}, fee, lockTime, UTXO)
+	if err != nil {
+		return nil, err
+	}
+	tx.ID = tx.Hash()
+
+	return tx, nil
+}
+
+//unsignedTransaction spends outputs locked to pubKeyHash, with the inputs
+//newInput makes, to pay outputs and fee to the forger. The change goes back
+//to from
+func unsignedTransaction(from string, pubKeyHash []byte, newInput func(txID []byte, out int) TxInput, outputs []TxOutput, fee int, lockTime int64, UTXO *UTXOSet) (*Transaction, error) {
+	var inputs []TxInput
+
+	amount := 0
+	negative := fee < 0 || lockTime < 0
+	for _, output := range outputs {
+		amount += output.Value
+		negative = negative || output.Value < 0 || output.LockBlocks < 0
+	}
+	if negative {
+		return nil, fmt.Errorf("amount, fee and locks cannot be negative")
+	}
+
+	//a transaction has to spend something even when it only carries data
+	needed := amount + fee
+	if needed == 0 {
+		needed = 1
+	}
 
-	if acc < amount {
-		log.Panic("Error: Not enough funds")
+	acc, validOutputs, err := UTXO.FindSpendableOutputs(pubKeyHash, needed)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc < needed {
+		return nil, ErrNotEnoughFunds
 	}
 
 	for txid, outs := range validOutputs {
 		txID, err := hex.DecodeString(txid)
-		Handler(err)
+		if err != nil {
+			return nil, err
+		}
 
 		for _, out := range outs {
-			input := TxInput{txID, Sender, out, nil, w.Publickey}
-			inputs = append(inputs, input)
+			inputs = append(inputs, newInput(txID, out))
 		}
 	}
 
-	from := fmt.Sprintf("%s", w.Address())
+	if acc > amount+fee {
+		outputs = append(outputs, TxOutput{acc - amount - fee, from, pubKeyHash, 0, nil})
+	}
 
-	outputs = append(outputs, *NewTxOutput(amount, Receiver))
+	return &Transaction{nil, inputs, outputs, lockTime}, nil
+}
 
-	// fee := amount / 10
+//BumpFee builds a replacement of tx, sent from w, that pays fee instead. It
+//spends the same inputs, parents holds the pending transactions among the
+//ones they spend from. The difference comes out of output change, which is
+//-1 when tx pays no change back, and more outputs of w are added when the
+//change is not enough
+func BumpFee(w *wallet.Wallet, tx *Transaction, parents map[string]Transaction, change, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	pubKeyHash := wallet.PublicKeyHash(w.Publickey)
+	for _, in := range tx.Inputs {
+		if !in.UsesKey(pubKeyHash) {
+			return nil, fmt.Errorf("transaction %x is not sent from %s", tx.ID, w.Address())
+		}
+	}
+	if change >= len(tx.Outputs) || change >= 0 && !tx.Outputs[change].IsLockedWithKey(pubKeyHash) {
+		return nil, fmt.Errorf("output %d of %x is not change of %s", change, tx.ID, w.Address())
+	}
 
-	// if acc > amount+fee {
-	// 	outputs = append(outputs, TxOutput{fee, acc - (fee + amount), pubKeyHash})
-	// }
+	prevTXs := make(map[string]Transaction)
+	for _, in := range tx.Inputs {
+		id := hex.EncodeToString(in.ID)
+		if _, ok := prevTXs[id]; ok {
+			continue
+		}
+		if parent, ok := parents[id]; ok {
+			prevTXs[id] = parent
+			continue
+		}
+
+		prevTX, err := UTXO.Blockchain.prevTransaction(in)
+		if err != nil {
+			return nil, err
+		}
+		prevTXs[id] = prevTX
+	}
 
-	if acc > amount {
-		outputs = append(outputs, TxOutput{acc - amount, from, pubKeyHash})
+	oldFee, err := tx.Fee(prevTXs)
+	if err != nil {
+		return nil, err
+	}
+	if fee <= oldFee {
+		return nil, fmt.Errorf("%w: %d is not above %d", ErrLowReplacementFee, fee, oldFee)
 	}
+	missing := fee - oldFee
 
-	tx := Transaction{nil, inputs, outputs}
-	tx.ID = tx.Hash()
-	chain.SignTransaction(&tx, w.PrivateKey)
+	var inputs []TxInput
+	used := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		inputs = append(inputs, TxInput{in.ID, in.SenderAddress, in.Out, nil, in.PubKey, nil, nil})
+		used[outpoint(in.ID, in.Out)] = true
+	}
+	outputs := append([]TxOutput{}, tx.Outputs...)
+
+	if change >= 0 && outputs[change].Value > missing {
+		outputs[change].Value -= missing
+		missing = 0
+	} else if change >= 0 {
+		missing -= outputs[change].Value
+		outputs = append(outputs[:change], outputs[change+1:]...)
+	}
+
+	if missing > 0 {
+		next, err := UTXO.Blockchain.nextSpendContext()
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		err = UTXO.forEachUnspent(pubKeyHash, func(txID []byte, outIdx int, outs TxOutputs, out TxOutput) bool {
+			if added >= missing {
+				return false
+			}
+			if used[outpoint(txID, outIdx)] || !next.canSpend(outs, out) || len(out.Script) > 0 {
+				return true
+			}
+			inputs = append(inputs, TxInput{txID, string(w.Address()), outIdx, nil, w.Publickey, nil, nil})
+			added += out.Value
+
+			//only the output spent is needed to sign
+			id := hex.EncodeToString(txID)
+			prevTX := prevTXs[id]
+			prevTX.ID = txID
+			for len(prevTX.Outputs) <= outIdx {
+				prevTX.Outputs = append(prevTX.Outputs, TxOutput{})
+			}
+			prevTX.Outputs[outIdx] = out
+			prevTXs[id] = prevTX
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if added < missing {
+			return nil, ErrNotEnoughFunds
+		}
+		if added > missing {
+			outputs = append(outputs, TxOutput{added - missing, string(w.Address()), pubKeyHash, 0, nil})
+		}
+	}
 
-	return &tx
+	bumped := Transaction{nil, inputs, outputs, tx.LockTime}
+	if err := bumped.Sign(w.PrivateKey, prevTXs); err != nil {
+		return nil, err
+	}
+	bumped.ID = bumped.Hash()
+
+	return &bumped, nil
 }
 
 func (tx *Transaction) SetID() {
-	var (
-		encoded bytes.Buffer
-		hash    [32]byte
-	)
+	tx.ID = tx.Hash()
+}
 
-	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(tx)
-	Handler(err)
+func (tx *Transaction) IsCoinbase() bool {
+	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
+}
 
-	hash = sha256.Sum256(encoded.Bytes())
-	tx.ID = hash[:]
+//StakeOf returns the address that signed the stake transaction tx and what it
+//pays itself. A stake spends the outputs of a single key and pays them all
+//back to it, so it shows the signer holds the coins. Signatures are left to
+//the caller
+func StakeOf(tx *Transaction) (string, int, error) {
+	if tx.IsCoinbase() || len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+		return "", 0, ErrBadStake
+	}
+
+	pubKey := tx.Inputs[0].PubKey
+	for _, in := range tx.Inputs {
+		if in.IsMultisig() || len(in.Unlock) > 0 || !bytes.Equal(in.PubKey, pubKey) {
+			return "", 0, ErrBadStake
+		}
+	}
+
+	pubKeyHash := wallet.PublicKeyHash(pubKey)
+	stake := 0
+	for _, out := range tx.Outputs {
+		if len(out.Script) > 0 || !out.IsLockedWithKey(pubKeyHash) {
+			return "", 0, ErrBadStake
+		}
+		stake += out.Value
+	}
+
+	return string(wallet.PubKeyAddress(pubKey)), stake, nil
 }
 
-func (tx *Transaction) isCoinbase() bool {
-	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
+//IsFinal tells whether tx can be forged in a block at height with timestamp
+func (tx *Transaction) IsFinal(height int, timestamp int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	if tx.LockTime < LockTimeThreshold {
+		return int64(height) >= tx.LockTime
+	}
+	return timestamp >= tx.LockTime
 }
 
-func (tx Transaction) Serialize() []byte {
-	var encoded bytes.Buffer
+//hasLocks tells whether tx needs encoding version 2 for its lock times
+func (tx *Transaction) hasLocks() bool {
+	if tx.LockTime != 0 {
+		return true
+	}
+	for _, out := range tx.Outputs {
+		if out.LockBlocks != 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	Handler(err)
+//hashVersion is the encoding version tx is hashed with, the first one
+//that can hold it, so transactions without the fields of later versions
+//keep their IDs
+func (tx *Transaction) hashVersion() byte {
+	for _, in := range tx.Inputs {
+		if len(in.Unlock) > 0 {
+			return 4
+		}
+	}
+	for _, out := range tx.Outputs {
+		if len(out.Script) > 0 {
+			return 4
+		}
+	}
+	for _, in := range tx.Inputs {
+		if in.IsMultisig() {
+			return 3
+		}
+	}
+	if tx.hasLocks() {
+		return 2
+	}
+	return 1
+}
 
-	return encoded.Bytes()
+func (tx Transaction) Serialize() []byte {
+	return serialize(func(e *encoder) { e.writeTransaction(&tx) })
 }
 
-func DeserializeTransaction(data []byte) Transaction {
+//DeserializeTransaction reads a transaction written by Serialize, or by the
+//gob encoding used before
+func DeserializeTransaction(data []byte) (Transaction, error) {
 	var transaction Transaction
 
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
-	Handler(err)
-	return transaction
+	if !isCanonical(data) {
+		decoder := gob.NewDecoder(bytes.NewReader(data))
+		err := decoder.Decode(&transaction)
+		return transaction, err
+	}
+
+	d, err := newDecoder(data)
+	if err != nil {
+		return transaction, err
+	}
+
+	transaction = d.readTransaction()
+	return transaction, d.finish()
 }
 
+//Hash is the ID of the transaction: the hash of its encoding without the ID
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
 
 	txCopy := *tx
 	txCopy.ID = []byte{}
 
-	hash = sha256.Sum256(txCopy.Serialize())
+	hash = sha256.Sum256(hashData(func(e *encoder) {
+		e.version = txCopy.hashVersion()
+		e.writeTransaction(&txCopy)
+	}))
 
 	return hash[:]
 }
 
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
-	if tx.isCoinbase() {
-		return
-	}
+//SigHash is what input inIdx signs: the hash of the encoding of the
+//transaction without its ID, signatures and public keys, where input inIdx
+//holds the public key hash of prevOut, the output it spends
+func (tx *Transaction) SigHash(inIdx int, prevOut TxOutput) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.ID = nil
+	txCopy.Inputs[inIdx].PubKey = prevOut.PubKeyHash
 
-	for _, in := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
-		}
+	hash := sha256.Sum256(hashData(func(e *encoder) {
+		e.version = txCopy.hashVersion()
+		e.writeTransaction(&txCopy)
+	}))
+
+	return hash[:]
+}
+
+//prevOutput returns the output spent by in, if prevTXs has it
+func prevOutput(in TxInput, prevTXs map[string]Transaction) (TxOutput, bool) {
+	prevTx, ok := prevTXs[hex.EncodeToString(in.ID)]
+	if !ok || prevTx.ID == nil || in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+		return TxOutput{}, false
 	}
 
-	txCopy := tx.TrimmedCopy()
+	return prevTx.Outputs[in.Out], true
+}
 
-	for inId, in := range txCopy.Inputs {
-		prevTX := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
+//Sign signs the inputs of tx privKey can unlock. A multisig input gets the
+//signature of the key of its redeem script, the other inputs and the ones
+//spending outputs locked by a script are left as they are
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
 
-		dataToSign := fmt.Sprintf("%x\n", txCopy)
+	pubKey := wallet.MarshalPublicKey(&privKey.PublicKey)
+	for inId, in := range tx.Inputs {
+		prevOut, ok := prevOutput(in, prevTXs)
+		if !ok {
+			return fmt.Errorf("%w: %x:%d", ErrTxNotFound, in.ID, in.Out)
+		}
+		if len(prevOut.Script) > 0 {
+			continue
+		}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, []byte(dataToSign))
-		Handler(err)
-		signature := append(r.Bytes(), s.Bytes()...)
+		slot := -1
+		if in.IsMultisig() {
+			_, keys, err := wallet.ParseRedeemScript(in.PubKey)
+			if err != nil {
+				return err
+			}
+			for i, key := range keys {
+				if bytes.Equal(key, pubKey) {
+					slot = i
+				}
+			}
+			if slot < 0 || slot >= len(in.Signatures) {
+				continue
+			}
+		} else if !bytes.Equal(in.PubKey, pubKey) {
+			continue
+		}
 
-		tx.Inputs[inId].Signature = signature
-		txCopy.Inputs[inId].PubKey = nil
+		signature, err := wallet.Sign(&privKey, tx.SigHash(inId, prevOut))
+		if err != nil {
+			return err
+		}
+		if slot >= 0 {
+			tx.Inputs[inId].Signatures[slot] = signature
+		} else {
+			tx.Inputs[inId].Signature = signature
+		}
 	}
+
+	return nil
 }
 
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
-	if tx.isCoinbase() {
-		return true
+//Verify runs the unlocking data of every input with the locking script of the
+//output it spends. ages are how many blocks before the spending block the
+//previous transactions were confirmed, by ID
+func (tx *Transaction) Verify(prevTXs map[string]Transaction, ages map[string]int) error {
+	if tx.IsCoinbase() {
+		return nil
 	}
 
-	for _, in := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-			log.Panic("Previous transaction not correct")
+	for inId, in := range tx.Inputs {
+		prevOut, ok := prevOutput(in, prevTXs)
+		if !ok {
+			return fmt.Errorf("%w: %x:%d", ErrTxNotFound, in.ID, in.Out)
+		}
+
+		env := &scriptEnv{tx, inId, prevOut, ages[hex.EncodeToString(in.ID)]}
+		if err := verifyScript(env); err != nil {
+			return fmt.Errorf("input %d: %w", inId, err)
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	return nil
+}
 
-	for inId, in := range tx.Inputs {
-		prevTx := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+//MissingSignatures is how many signatures the multisig inputs of tx still
+//need, counting the input missing the most
+func (tx *Transaction) MissingSignatures() int {
+	missing := 0
 
-		pubKeyHash, err := x509.ParsePKCS1PublicKey(in.PubKey)
-		if err != nil {
-			log.Panic(err)
+	for _, in := range tx.Inputs {
+		if !in.IsMultisig() {
+			continue
 		}
-		err = rsa.VerifyPSS(pubKeyHash, crypto.SHA256, txCopy.ID, in.Signature, nil)
+		m, _, err := wallet.ParseRedeemScript(in.PubKey)
 		if err != nil {
-			return false
+			continue
+		}
+		for _, signature := range in.Signatures {
+			if len(signature) != 0 {
+				m--
+			}
 		}
+		if m > missing {
+			missing = m
+		}
+	}
+
+	return missing
+}
+
+//Fee is what the inputs of tx hold beyond its outputs. It fails when an output
+//is negative or the outputs are worth more than the inputs
+func (tx *Transaction) Fee(prevTXs map[string]Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	fee := 0
+	for _, in := range tx.Inputs {
+		prevOut, ok := prevOutput(in, prevTXs)
+		if !ok {
+			return 0, ruleError(ErrMissingInput, "%x:%d", in.ID, in.Out)
+		}
+		fee += prevOut.Value
+	}
+
+	for _, out := range tx.Outputs {
+		if out.Value < 0 {
+			return 0, ruleError(ErrBadValue, "%x", tx.ID)
+		}
+		fee -= out.Value
+	}
+
+	if fee < 0 {
+		return 0, ruleError(ErrBadFee, "%x is short by %d", tx.ID, -fee)
 	}
 
-	return true
+	return fee, nil
 }
 
 func (tx *Transaction) TrimmedCopy() Transaction {
@@ -203,15 +626,15 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TxOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TxInput{in.ID, in.SenderAddress, in.Out, nil, nil})
+		inputs = append(inputs, TxInput{in.ID, in.SenderAddress, in.Out, nil, nil, nil, nil})
 	}
 
 	for _, out := range tx.Outputs {
 		// outputs = append(outputs, TxOutput{out.Fees, out.Value, out.PubKeyHash})
-		outputs = append(outputs, TxOutput{out.Value, out.Address, out.PubKeyHash})
+		outputs = append(outputs, TxOutput{out.Value, out.Address, out.PubKeyHash, out.LockBlocks, out.Script})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
@@ -220,31 +643,52 @@ func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
+	}
 	for i, input := range tx.Inputs {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:     %x", input.ID))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Out))
 		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
 		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PubKey))
+		for j, signature := range input.Signatures {
+			lines = append(lines, fmt.Sprintf("       Signature %d: %x", j, signature))
+		}
+		if len(input.Unlock) > 0 {
+			lines = append(lines, fmt.Sprintf("       Unlock:    %s", DisasmScript(input.Unlock)))
+		}
 	}
 
 	for i, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
 		lines = append(lines, fmt.Sprintf("       Script: %x", output.PubKeyHash))
+		if len(output.Script) > 0 {
+			lines = append(lines, fmt.Sprintf("       Lock:   %s", DisasmScript(output.Script)))
+		}
+		if output.LockBlocks != 0 {
+			lines = append(lines, fmt.Sprintf("       LockBlocks: %d", output.LockBlocks))
+		}
 	}
 
 	return strings.Join(lines, "\n")
 }
 
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
-		prevTX, err := bc.FindTransaction(in.ID)
-		Handler(err)
+		if out, ok := prevOutput(in, prevTXs); ok && out.PubKeyHash != nil {
+			continue
+		}
+
+		prevTX, err := bc.prevTransaction(in)
+		if err != nil {
+			return err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
+	return tx.Sign(privKey, prevTXs)
 }
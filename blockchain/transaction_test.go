@@ -0,0 +1,115 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/test-blockchain/wallet"
+)
+
+func TestStakeOf(t *testing.T) {
+	chain, a := newTestChain(t)
+	b := newTestWallet(t)
+
+	stake, err := NewTransaction(a, string(a.Address()), string(a.Address()), 30, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, value, err := StakeOf(stake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != string(a.Address()) || value != defaultAllocation {
+		t.Fatalf("got %s staking %d, want %s staking %d", address, value, a.Address(), defaultAllocation)
+	}
+
+	payment, err := NewTransaction(a, string(a.Address()), string(b.Address()), 30, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noInputs := *stake
+	noInputs.Inputs = nil
+	noOutputs := *stake
+	noOutputs.Outputs = nil
+	otherKey := *stake
+	otherKey.Inputs = []TxInput{stake.Inputs[0]}
+	otherKey.Inputs[0].PubKey = b.Publickey
+
+	for name, tx := range map[string]*Transaction{
+		"payment":    payment,
+		"no inputs":  &noInputs,
+		"no outputs": &noOutputs,
+		"other key":  &otherKey,
+	} {
+		if _, _, err := StakeOf(tx); !errors.Is(err, ErrBadStake) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrBadStake)
+		}
+	}
+}
+
+//copyTransaction copies tx deep enough to change its inputs and outputs
+func copyTransaction(tx *Transaction) *Transaction {
+	c := *tx
+	c.Inputs = append([]TxInput{}, tx.Inputs...)
+	c.Outputs = append([]TxOutput{}, tx.Outputs...)
+	return &c
+}
+
+func TestTransactionSignatures(t *testing.T) {
+	chain, a := newTestChain(t)
+	b := newTestWallet(t)
+
+	genesis := tipBlock(t, chain).Transaction[0]
+	prevTXs := map[string]Transaction{hex.EncodeToString(genesis.ID): *genesis}
+
+	tx, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Verify(prevTXs, nil); err != nil {
+		t.Fatalf("signed by NewTransaction: %s", err)
+	}
+
+	bOutput, err := NewTxOutput(10, string(b.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := map[string]func(tx *Transaction){
+		"amount":    func(tx *Transaction) { tx.Outputs[0].Value++ },
+		"receiver":  func(tx *Transaction) { tx.Outputs[1] = *bOutput },
+		"extra":     func(tx *Transaction) { tx.Outputs = append(tx.Outputs, *bOutput) },
+		"lock time": func(tx *Transaction) { tx.LockTime++ },
+		"other key": func(tx *Transaction) { tx.Inputs[0].PubKey = b.Publickey },
+		"signature": func(tx *Transaction) {
+			tx.Inputs[0].Signature = append([]byte{}, tx.Inputs[0].Signature...)
+			tx.Inputs[0].Signature[len(tx.Inputs[0].Signature)-1] ^= 1
+		},
+	}
+	for name, tamper := range tampered {
+		c := copyTransaction(tx)
+		tamper(c)
+		if err := c.Verify(prevTXs, nil); err == nil {
+			t.Errorf("%s tampered: verified", name)
+		}
+	}
+
+	//a signature over another output of the same transaction
+	moved := copyTransaction(tx)
+	moved.Inputs[0].Out = 1
+	other := *genesis
+	other.Outputs = []TxOutput{genesis.Outputs[0], genesis.Outputs[0]}
+	if err := moved.Verify(map[string]Transaction{hex.EncodeToString(genesis.ID): other}, nil); err == nil {
+		t.Error("input moved to another output: verified")
+	}
+
+	//signed by b for an output of a
+	forged := copyTransaction(tx)
+	forged.Inputs[0].Signature, err = wallet.Sign(&b.PrivateKey, tx.SigHash(0, genesis.Outputs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := forged.Verify(prevTXs, nil); err == nil {
+		t.Error("signed with another key: verified")
+	}
+}
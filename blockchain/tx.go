@@ -12,6 +12,12 @@ type (
 		Value      int
 		Address    string
 		PubKeyHash []byte
+		//LockBlocks is how many blocks after the one that confirms it the
+		//output can be spent, 0 can be spent right away
+		LockBlocks int
+		//Script locks the output instead of the PayToPubKeyHash template,
+		//PubKeyHash is then the hash of Script
+		Script []byte
 	}
 
 	TxInput struct {
@@ -20,17 +26,44 @@ type (
 		Out           int
 		Signature     []byte
 		PubKey        []byte
+		//Signatures are set instead of Signature when the input spends a
+		//multisig output, PubKey then holds the redeem script. There is one
+		//per key of the script, empty for the keys that did not sign
+		Signatures [][]byte
+		//Unlock is the data pushed before the Script of the output runs, set
+		//instead of the signatures for outputs locked by a script
+		Unlock []byte
 	}
 
+	//TxOutputs is what the UTXO index stores per transaction. Indexes keeps the
+	//position of every output in its transaction once spent ones are removed,
+	//Height is the height of the block that confirmed the transaction and
+	//Coinbase tells whether it is a coinbase, whose outputs have to mature
 	TxOutputs struct {
-		Outputs []TxOutput
+		Outputs  []TxOutput
+		Indexes  []int
+		Height   int
+		Coinbase bool
 	}
 )
 
-func NewTxOutput(value int, address string) *TxOutput {
-	txo := &TxOutput{value, address, nil}
-	txo.Lock([]byte(address))
-	return txo
+func NewTxOutput(value int, address string) (*TxOutput, error) {
+	txo := &TxOutput{value, address, nil, 0, nil}
+	if err := txo.Lock([]byte(address)); err != nil {
+		return nil, err
+	}
+	return txo, nil
+}
+
+//NewScriptOutput locks value with script, its address is the one of the
+//hash of script
+func NewScriptOutput(value int, script []byte) (*TxOutput, error) {
+	if err := checkScript(script); err != nil {
+		return nil, err
+	}
+	address := string(wallet.ScriptAddress(script))
+
+	return &TxOutput{value, address, wallet.PublicKeyHash(script), 0, script}, nil
 }
 
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
@@ -39,28 +72,34 @@ func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
 
-func (out *TxOutput) Lock(address []byte) {
-	fullhash := wallet.Base58Decode(address)
-	pubKeyHash := fullhash[:len(fullhash)-4]
+//IsMultisig tells whether in spends a multisig output
+func (in *TxInput) IsMultisig() bool {
+	return len(in.Signatures) > 0
+}
+
+func (out *TxOutput) Lock(address []byte) error {
+	pubKeyHash, err := wallet.AddressToPubKeyHash(string(address))
+	if err != nil {
+		return err
+	}
 	out.PubKeyHash = pubKeyHash
+	return nil
 }
 
 func (out *TxOutput) IsLockedWithKey(pubKeyhash []byte) bool {
 	return bytes.Compare(out.PubKeyHash, pubKeyhash) == 0
 }
 
-func (outs TxOutputs) Serialize() []byte {
+func (outs TxOutputs) Serialize() ([]byte, error) {
 	var buffer bytes.Buffer
 	encode := gob.NewEncoder(&buffer)
 	err := encode.Encode(outs)
-	Handler(err)
-	return buffer.Bytes()
+	return buffer.Bytes(), err
 }
 
-func DeserializeOutputs(data []byte) TxOutputs {
+func DeserializeOutputs(data []byte) (TxOutputs, error) {
 	var outputs TxOutputs
 	decode := gob.NewDecoder(bytes.NewReader(data))
 	err := decode.Decode(&outputs)
-	Handler(err)
-	return outputs
+	return outputs, err
 }
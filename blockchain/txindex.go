@@ -0,0 +1,249 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type (
+	//TxLocation is where the transaction index finds a transaction
+	TxLocation struct {
+		BlockHash []byte
+		Position  int
+	}
+
+	//TxProof shows that a transaction is in a block to a client that only has
+	//the headers
+	TxProof struct {
+		TxID      []byte
+		BlockHash []byte
+		Header    BlockHeader
+		Proof     MerkleProof
+	}
+
+	//TxInfo is a transaction together with the main chain block holding it
+	TxInfo struct {
+		Transaction   Transaction
+		BlockHash     []byte
+		Height        int
+		Confirmations int
+	}
+)
+
+var (
+	//tx-<txid> holds the TxLocation of a main chain transaction
+	txIndexPrefix = []byte("tx-")
+	//txindex is set once the transaction index has been built
+	txIndexFlag = []byte("txindex")
+)
+
+func txIndexKey(txID []byte) []byte {
+	return append(append([]byte{}, txIndexPrefix...), txID...)
+}
+
+func (l TxLocation) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(l)
+	return buffer.Bytes(), err
+}
+
+func DeserializeTxLocation(data []byte) (TxLocation, error) {
+	var location TxLocation
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&location)
+	return location, err
+}
+
+func txIndexEnabled(txn StoreTxn) bool {
+	return hasKey(txn, txIndexFlag)
+}
+
+//indexTransactions adds the transactions of a connected block to the index
+func indexTransactions(txn StoreTxn, block *Block) error {
+	if !txIndexEnabled(txn) {
+		return nil
+	}
+
+	for i, tx := range block.Transaction {
+		location, err := TxLocation{block.Hash, i}.Serialize()
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(txIndexKey(tx.ID), location); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//unindexTransactions removes the transactions of a disconnected block
+func unindexTransactions(txn StoreTxn, block *Block) error {
+	if !txIndexEnabled(txn) {
+		return nil
+	}
+
+	for _, tx := range block.Transaction {
+		if err := txn.Delete(txIndexKey(tx.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//HasTxIndex reports whether the transaction index has been built
+func (chain *Blockchain) HasTxIndex() bool {
+	enabled := false
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		enabled = txIndexEnabled(txn)
+		return nil
+	})
+
+	return err == nil && enabled
+}
+
+//ReindexTransactions builds the transaction index from the main chain and
+//keeps it updated from then on
+func (chain *Blockchain) ReindexTransactions() (int, error) {
+	if err := chain.DeleteByPrefix(txIndexPrefix); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	batch := chain.Database.NewBatch()
+
+	iter := chain.Iterate()
+	for {
+		block, err := iter.Next()
+		if err != nil {
+			return count, err
+		}
+
+		for i, tx := range block.Transaction {
+			location, err := TxLocation{block.Hash, i}.Serialize()
+			if err != nil {
+				return count, err
+			}
+			if err := batch.Set(txIndexKey(tx.ID), location); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if iter.Done() {
+			break
+		}
+	}
+
+	if err := batch.Set(txIndexFlag, []byte{}); err != nil {
+		return count, err
+	}
+
+	return count, batch.Flush()
+}
+
+//GetTransaction returns a main chain transaction with its block and number of
+//confirmations. Without the transaction index the chain is walked from the tip
+func (chain *Blockchain) GetTransaction(ID []byte) (TxInfo, error) {
+	var info TxInfo
+
+	tx, block, err := chain.findTransaction(ID)
+	if err != nil {
+		return info, err
+	}
+
+	lastHeight, err := chain.GetLastHeight()
+	if err != nil {
+		return info, err
+	}
+
+	info.Transaction = tx
+	info.BlockHash = block.Hash
+	info.Height = block.Height
+	info.Confirmations = lastHeight - block.Height + 1
+
+	return info, nil
+}
+
+//GetTxProof returns the merkle proof of a main chain transaction
+func (chain *Blockchain) GetTxProof(ID []byte) (TxProof, error) {
+	var txProof TxProof
+
+	_, block, err := chain.findTransaction(ID)
+	if err != nil {
+		return txProof, err
+	}
+
+	proof, err := block.MerkleProof(ID)
+	if err != nil {
+		return txProof, err
+	}
+
+	return TxProof{ID, block.Hash, block.BlockHeader, proof}, nil
+}
+
+//Verify checks that the proof leads to the merkle root of the header and that
+//the header hashes to the block hash
+func (p TxProof) Verify() bool {
+	return bytes.Equal(p.Header.Hash(), p.BlockHash) && VerifyMerkleProof(p.Header.MerkleRoot, p.TxID, p.Proof)
+}
+
+func (chain *Blockchain) findTransaction(ID []byte) (Transaction, *Block, error) {
+	var (
+		tx      Transaction
+		block   *Block
+		indexed bool
+	)
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		if !txIndexEnabled(txn) {
+			return nil
+		}
+		indexed = true
+
+		v, err := txn.Get(txIndexKey(ID))
+		if err == ErrKeyNotFound {
+			return ErrTxNotFound
+		} else if err != nil {
+			return err
+		}
+		location, err := DeserializeTxLocation(v)
+		if err != nil {
+			return err
+		}
+
+		block, err = getBlock(txn, location.BlockHash)
+		if err != nil {
+			return err
+		}
+		tx = *block.Transaction[location.Position]
+
+		return nil
+	})
+	if err != nil || indexed {
+		return tx, block, err
+	}
+
+	iter := chain.Iterate()
+	for {
+		block, err := iter.Next()
+		if err != nil {
+			return tx, nil, err
+		}
+
+		for _, tx := range block.Transaction {
+			if bytes.Equal(tx.ID, ID) {
+				return *tx, block, nil
+			}
+		}
+
+		if iter.Done() {
+			break
+		}
+	}
+
+	return tx, nil, ErrTxNotFound
+}
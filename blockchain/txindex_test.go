@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetTransaction(t *testing.T) {
+	chain, _ := newTestChain(t)
+	forger := newTestWallet(t)
+	genesis := tipBlock(t, chain)
+
+	m1 := addTestBlock(t, chain, genesis, forger, 0)
+	m2 := addTestBlock(t, chain, m1, forger, 0)
+	tx := m1.Transaction[0]
+
+	check := func(name string) {
+		t.Helper()
+		info, err := chain.GetTransaction(tx.ID)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(info.Transaction.ID, tx.ID) || !bytes.Equal(info.BlockHash, m1.Hash) || info.Height != 1 || info.Confirmations != 2 {
+			t.Fatalf("%s: got %x in %x at %d with %d confirmations", name, info.Transaction.ID, info.BlockHash, info.Height, info.Confirmations)
+		}
+		if _, err := chain.GetTransaction([]byte("unknown")); err == nil {
+			t.Fatalf("%s: found an unknown transaction", name)
+		}
+	}
+
+	if chain.HasTxIndex() {
+		t.Fatal("transaction index is built before reindextx")
+	}
+	check("scan")
+
+	if count, err := chain.ReindexTransactions(); err != nil || count != 3 {
+		t.Fatalf("indexed %d transactions (%v), want 3", count, err)
+	}
+	if !chain.HasTxIndex() {
+		t.Fatal("transaction index not built by reindextx")
+	}
+	check("index")
+
+	//blocks connected from now on are indexed, disconnected ones unindexed
+	m3 := addTestBlock(t, chain, m2, forger, 0)
+	indexed := func(tx *Transaction) bool {
+		found := false
+		err := chain.Database.View(func(txn StoreTxn) error {
+			_, err := txn.Get(txIndexKey(tx.ID))
+			found = err == nil
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+	if !indexed(m3.Transaction[0]) {
+		t.Fatal("transaction of a new block not indexed")
+	}
+
+	side := genesis
+	for i := 0; i < 4; i++ {
+		side = addTestBlock(t, chain, side, newTestWallet(t), 0)
+	}
+	if indexed(m3.Transaction[0]) {
+		t.Fatal("transaction of a disconnected block still indexed")
+	}
+	if !indexed(side.Transaction[0]) {
+		t.Fatal("transaction of the new branch not indexed")
+	}
+}
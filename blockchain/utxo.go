@@ -0,0 +1,369 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+type (
+	//UTXOSet is the index of unspent outputs kept next to the blocks in the store
+	UTXOSet struct {
+		Blockchain *Blockchain
+	}
+)
+
+var (
+	//utxo-<txid> holds the unspent outputs of one transaction
+	utxoPrefix = []byte("utxo-")
+	//utxa-<pubKeyHash><txid> marks that txid still has an output locked to pubKeyHash
+	utxoAddrPrefix = []byte("utxa-")
+)
+
+func utxoKey(txID []byte) []byte {
+	return append(append([]byte{}, utxoPrefix...), txID...)
+}
+
+func utxoAddrKey(pubKeyHash, txID []byte) []byte {
+	key := append(append([]byte{}, utxoAddrPrefix...), pubKeyHash...)
+	return append(key, txID...)
+}
+
+//Reindex drops the whole UTXO index and rebuilds it by walking the chain
+func (u UTXOSet) Reindex() error {
+	if err := u.Blockchain.DeleteByPrefix(utxoPrefix); err != nil {
+		return err
+	}
+	if err := u.Blockchain.DeleteByPrefix(utxoAddrPrefix); err != nil {
+		return err
+	}
+
+	UTXO, err := u.Blockchain.FindUTXO()
+	if err != nil {
+		return err
+	}
+
+	batch := u.Blockchain.Database.NewBatch()
+	for txId, outs := range UTXO {
+		key, err := hex.DecodeString(txId)
+		if err != nil {
+			return err
+		}
+
+		data, err := outs.Serialize()
+		if err != nil {
+			return err
+		}
+		if err := batch.Set(utxoKey(key), data); err != nil {
+			return err
+		}
+		for _, out := range outs.Outputs {
+			if err := batch.Set(utxoAddrKey(out.PubKeyHash, key), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.Flush()
+}
+
+//updateUTXO applies a block that became part of the main chain to the UTXO
+//index and returns the outputs it spent, so the block can be undone later.
+//Data outputs are left out, nobody can spend them
+func updateUTXO(txn StoreTxn, block *Block) ([]SpentOutput, error) {
+	var spentOutputs []SpentOutput
+
+	for _, tx := range block.Transaction {
+		if tx.IsCoinbase() == false {
+			for _, in := range tx.Inputs {
+				spent, err := spendUTXO(txn, in.ID, in.Out)
+				if err != nil {
+					return nil, err
+				}
+				spentOutputs = append(spentOutputs, spent)
+			}
+		}
+
+		newOutputs := TxOutputs{Height: block.Height, Coinbase: tx.IsCoinbase()}
+		for outIdx, out := range tx.Outputs {
+			if out.IsData() {
+				continue
+			}
+			newOutputs.Outputs = append(newOutputs.Outputs, out)
+			newOutputs.Indexes = append(newOutputs.Indexes, outIdx)
+
+			if err := txn.Set(utxoAddrKey(out.PubKeyHash, tx.ID), []byte{}); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(newOutputs.Outputs) == 0 {
+			continue
+		}
+		data, err := newOutputs.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		if err := txn.Set(utxoKey(tx.ID), data); err != nil {
+			return nil, err
+		}
+	}
+
+	return spentOutputs, nil
+}
+
+//revertUTXO undoes updateUTXO: the outputs created by block are removed and
+//the outputs it spent are put back
+func revertUTXO(txn StoreTxn, block *Block, spentOutputs []SpentOutput) error {
+	spent := make(map[string]SpentOutput)
+	for _, s := range spentOutputs {
+		spent[fmt.Sprintf("%x:%d", s.TxID, s.Index)] = s
+	}
+
+	for i := len(block.Transaction) - 1; i >= 0; i-- {
+		tx := block.Transaction[i]
+
+		for _, out := range tx.Outputs {
+			if out.IsData() {
+				continue
+			}
+			if err := txn.Delete(utxoAddrKey(out.PubKeyHash, tx.ID)); err != nil {
+				return err
+			}
+		}
+		if err := txn.Delete(utxoKey(tx.ID)); err != nil {
+			return err
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			s, ok := spent[fmt.Sprintf("%x:%d", in.ID, in.Out)]
+			if !ok {
+				return fmt.Errorf("no undo data for %x:%d", in.ID, in.Out)
+			}
+			if err := restoreUTXO(txn, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//spendUTXO removes output outIdx of txID from the index and returns it with
+//what is needed to put it back
+func spendUTXO(txn StoreTxn, txID []byte, outIdx int) (SpentOutput, error) {
+	spent := SpentOutput{TxID: txID, Index: outIdx}
+
+	v, err := txn.Get(utxoKey(txID))
+	if err == ErrKeyNotFound {
+		return spent, ruleError(ErrMissingInput, "%x:%d", txID, outIdx)
+	} else if err != nil {
+		return spent, err
+	}
+	outs, err := DeserializeOutputs(v)
+	if err != nil {
+		return spent, err
+	}
+	spent.Height = outs.Height
+	spent.Coinbase = outs.Coinbase
+
+	var found bool
+	remaining := TxOutputs{Height: outs.Height, Coinbase: outs.Coinbase}
+	for i, out := range outs.Outputs {
+		if outs.Indexes[i] == outIdx {
+			spent.Output = out
+			found = true
+			continue
+		}
+		remaining.Outputs = append(remaining.Outputs, out)
+		remaining.Indexes = append(remaining.Indexes, outs.Indexes[i])
+	}
+	if !found {
+		return spent, ruleError(ErrMissingInput, "%x:%d", txID, outIdx)
+	}
+
+	stillLocked := false
+	for _, out := range remaining.Outputs {
+		if out.IsLockedWithKey(spent.Output.PubKeyHash) {
+			stillLocked = true
+		}
+	}
+	if !stillLocked {
+		if err := txn.Delete(utxoAddrKey(spent.Output.PubKeyHash, txID)); err != nil {
+			return spent, err
+		}
+	}
+
+	if len(remaining.Outputs) == 0 {
+		return spent, txn.Delete(utxoKey(txID))
+	}
+
+	data, err := remaining.Serialize()
+	if err != nil {
+		return spent, err
+	}
+	return spent, txn.Set(utxoKey(txID), data)
+}
+
+//restoreUTXO puts a spent output back at its position in the index
+func restoreUTXO(txn StoreTxn, s SpentOutput) error {
+	var outs TxOutputs
+
+	v, err := txn.Get(utxoKey(s.TxID))
+	if err == nil {
+		if outs, err = DeserializeOutputs(v); err != nil {
+			return err
+		}
+	} else if err != ErrKeyNotFound {
+		return err
+	}
+
+	restored := TxOutputs{Height: s.Height, Coinbase: s.Coinbase}
+	inserted := false
+	for i, out := range outs.Outputs {
+		if !inserted && outs.Indexes[i] > s.Index {
+			restored.Outputs = append(restored.Outputs, s.Output)
+			restored.Indexes = append(restored.Indexes, s.Index)
+			inserted = true
+		}
+		restored.Outputs = append(restored.Outputs, out)
+		restored.Indexes = append(restored.Indexes, outs.Indexes[i])
+	}
+	if !inserted {
+		restored.Outputs = append(restored.Outputs, s.Output)
+		restored.Indexes = append(restored.Indexes, s.Index)
+	}
+
+	if err := txn.Set(utxoAddrKey(s.Output.PubKeyHash, s.TxID), []byte{}); err != nil {
+		return err
+	}
+
+	data, err := restored.Serialize()
+	if err != nil {
+		return err
+	}
+	return txn.Set(utxoKey(s.TxID), data)
+}
+
+//IsUnspent tells whether output outIdx of txID is in the UTXO index
+func (u UTXOSet) IsUnspent(txID []byte, outIdx int) (bool, error) {
+	found := false
+
+	err := u.Blockchain.Database.View(func(txn StoreTxn) error {
+		v, err := txn.Get(utxoKey(txID))
+		if err == ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		outs, err := DeserializeOutputs(v)
+		if err != nil {
+			return err
+		}
+		for _, idx := range outs.Indexes {
+			found = found || idx == outIdx
+		}
+		return nil
+	})
+
+	return found, err
+}
+
+//FindUTXO returns the unspent outputs locked to pubKeyHash
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]TxOutput, error) {
+	var UTXOs []TxOutput
+
+	err := u.forEachUnspent(pubKeyHash, func(txID []byte, outIdx int, outs TxOutputs, out TxOutput) bool {
+		UTXOs = append(UTXOs, out)
+		return true
+	})
+
+	return UTXOs, err
+}
+
+//FindSpendableOutputs picks unspent outputs of pubKeyHash until amount is
+//covered, leaving out the ones the next block could not spend: coinbase
+//outputs that have not matured and outputs still locked. Outputs locked by a
+//script are left out too, the wallet cannot unlock them
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+
+	next, err := u.Blockchain.nextSpendContext()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = u.forEachUnspent(pubKeyHash, func(txID []byte, outIdx int, outs TxOutputs, out TxOutput) bool {
+		//to validate so the user wont be able to sent money if they didnt have enough balances
+		if accumulated >= amount {
+			return false
+		}
+		id := hex.EncodeToString(txID)
+		if !next.canSpend(outs, out) || len(out.Script) > 0 {
+			return true
+		}
+		accumulated += out.Value
+		unspentOuts[id] = append(unspentOuts[id], outIdx)
+
+		return true
+	})
+
+	return accumulated, unspentOuts, err
+}
+
+//forEachUnspent only visits the transactions listed under pubKeyHash, so the
+//cost grows with the number of outputs of the address instead of the chain
+func (u UTXOSet) forEachUnspent(pubKeyHash []byte, fn func(txID []byte, outIdx int, outs TxOutputs, out TxOutput) bool) error {
+	prefix := append(append([]byte{}, utxoAddrPrefix...), pubKeyHash...)
+
+	return u.Blockchain.Database.View(func(txn StoreTxn) error {
+		var txIDs [][]byte
+
+		err := txn.Iterate(prefix, func(key, value []byte) bool {
+			txIDs = append(txIDs, key[len(prefix):])
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, txID := range txIDs {
+			v, err := txn.Get(utxoKey(txID))
+			if err != nil {
+				return err
+			}
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+
+			for i, out := range outs.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					if !fn(txID, outs.Indexes[i], outs, out) {
+						return nil
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+//CountTransactions returns how many transactions still have unspent outputs
+func (u UTXOSet) CountTransactions() (int, error) {
+	counter := 0
+
+	err := u.Blockchain.Database.View(func(txn StoreTxn) error {
+		return txn.Iterate(utxoPrefix, func(key, value []byte) bool {
+			counter++
+			return true
+		})
+	})
+
+	return counter, err
+}
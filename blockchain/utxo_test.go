@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+//utxoIndex returns every key of the UTXO index with its value
+func utxoIndex(t *testing.T, chain *Blockchain) map[string]string {
+	t.Helper()
+
+	index := make(map[string]string)
+	err := chain.Database.View(func(txn StoreTxn) error {
+		for _, prefix := range [][]byte{utxoPrefix, utxoAddrPrefix} {
+			err := txn.Iterate(prefix, func(key, value []byte) bool {
+				index[fmt.Sprintf("%x", key)] = string(value)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestReindexMatchesUpdates(t *testing.T) {
+	chain, a := newTestChain(t)
+	b, forger := newTestWallet(t), newTestWallet(t)
+
+	UTXO := &UTXOSet{chain}
+
+	toB, err := NewTransaction(a, string(a.Address()), string(b.Address()), 10, 1, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1 := addTestBlock(t, chain, tipBlock(t, chain), forger, 1, toB)
+	toA, err := NewTransaction(b, string(b.Address()), string(a.Address()), 4, 1, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestBlock(t, chain, m1, forger, 1, toA)
+
+	updated := utxoIndex(t, chain)
+	if err := UTXO.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if reindexed := utxoIndex(t, chain); !reflect.DeepEqual(reindexed, updated) {
+		t.Fatalf("reindexed UTXO set has %d keys, the updated one %d", len(reindexed), len(updated))
+	}
+
+	if got, want := [3]int{balance(t, chain, a), balance(t, chain, b), balance(t, chain, forger)}, [3]int{43, 5, chain.Config.BlockSubsidy(1) + chain.Config.BlockSubsidy(2) + 2}; got != want {
+		t.Fatalf("balances %v, want %v", got, want)
+	}
+}
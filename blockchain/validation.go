@@ -0,0 +1,364 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/test-blockchain/wallet"
+)
+
+type (
+	//RuleError is returned when a block breaks a consensus rule. Err is one of
+	//the Err* values below so callers can use errors.Is to find the broken rule
+	RuleError struct {
+		Err    error
+		Detail string
+	}
+
+	//spendContext is the block transactions are checked for
+	spendContext struct {
+		height    int
+		timestamp int64
+		//maturity is how many blocks later coinbase outputs can be spent
+		maturity int
+	}
+)
+
+const (
+	//BlockReward is the default value the coinbase of a forged block mints, a
+	//genesis file can set another one and a schedule for it
+	BlockReward = 20
+)
+
+var (
+	ErrBadBlockHash   = errors.New("block hash does not match its contents")
+	ErrBadMerkleRoot  = errors.New("merkle root does not match the transactions")
+	ErrBadVersion     = errors.New("block version is not supported")
+	ErrBadChainID     = errors.New("block belongs to another chain")
+	ErrBadTimestamp   = errors.New("block is older than its parent")
+	ErrBadGenesis     = errors.New("genesis block is not valid")
+	ErrNoTransactions = errors.New("block has no transactions")
+	ErrUnknownParent  = errors.New("previous block is not known")
+	ErrBadHeight      = errors.New("block height is not parent height + 1")
+	ErrBadCoinbase    = errors.New("block must start with exactly one coinbase")
+	ErrBadReward      = errors.New("coinbase does not pay the block reward and fees")
+	ErrBadSignature   = errors.New("transaction signature is not valid")
+	ErrBadScript      = errors.New("output script is not valid")
+	ErrBadDataOutput  = errors.New("data output is not valid")
+	ErrNoInputs       = errors.New("transaction has no inputs")
+	ErrBadTxID        = errors.New("transaction ID does not match its contents")
+	ErrDoubleSpend    = errors.New("output is spent twice")
+	ErrMissingInput   = errors.New("input refers to an unknown or spent output")
+	ErrBadValue       = errors.New("output value is negative")
+	ErrBadFee         = errors.New("inputs do not cover the outputs")
+	ErrImmatureSpend  = errors.New("coinbase output is spent before it matured")
+	ErrLockTime       = errors.New("transaction is forged before its lock time")
+	ErrRelativeLock   = errors.New("output is spent before its lock blocks passed")
+)
+
+func (e RuleError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Err, e.Detail)
+}
+
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+func ruleError(err error, format string, args ...interface{}) error {
+	return RuleError{err, fmt.Sprintf(format, args...)}
+}
+
+//ValidateBlock checks a block against every consensus rule that does not need
+//the UTXO state, so blocks of any branch can be checked before they are
+//stored. The rest is checked by checkConnect when the block is connected
+func (chain *Blockchain) ValidateBlock(block *Block) error {
+	if len(block.Transaction) == 0 {
+		return ruleError(ErrNoTransactions, "%x", block.Hash)
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ruleError(ErrBadMerkleRoot, "%x", block.Hash)
+	}
+
+	if !bytes.Equal(block.Hash, block.BlockHashing()) {
+		return ruleError(ErrBadBlockHash, "%x", block.Hash)
+	}
+
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return ruleError(ErrUnknownParent, "%x", block.PrevHash)
+	}
+
+	if err := checkHeader(&block.BlockHeader, &parent.BlockHeader); err != nil {
+		return err
+	}
+
+	for i, tx := range block.Transaction {
+		if tx.IsCoinbase() != (i == 0) {
+			return ruleError(ErrBadCoinbase, "transaction %d", i)
+		}
+	}
+
+	if err := checkDoubleSpend(block); err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transaction {
+		if !bytes.Equal(tx.ID, tx.Hash()) {
+			return ruleError(ErrBadTxID, "%x", tx.ID)
+		}
+		if !tx.IsFinal(block.Height, block.Timestamp) {
+			return ruleError(ErrLockTime, "%x is locked until %d", tx.ID, tx.LockTime)
+		}
+		if err := checkTransaction(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//checkConnect checks the rules of block that need the UTXO state: the outputs
+//it spends, their maturity and locks, the scripts unlocking them and what its
+//coinbase pays. txn holds the state of the parent of block
+func (chain *Blockchain) checkConnect(txn StoreTxn, block *Block) error {
+	//legacy blocks were checked by the rules of their time, connecting them
+	//still fails when they spend an output that is not there
+	if block.Version == LegacyBlockVersion {
+		return nil
+	}
+
+	ctx := &spendContext{block.Height, block.Timestamp, chain.Config.Params.CoinbaseMaturity}
+
+	fees := 0
+	blockTxs := make(map[string]Transaction)
+	for _, tx := range block.Transaction {
+		fee, err := chain.verifyBlockTransaction(txn, tx, blockTxs, ctx)
+		if err != nil {
+			return err
+		}
+		fees += fee
+		blockTxs[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	return checkCoinbase(block, chain.Config.BlockSubsidy(block.Height)+fees)
+}
+
+//checkHeader checks the rules a header has to follow given its parent
+func checkHeader(header, parent *BlockHeader) error {
+	if header.Version != BlockVersion {
+		return ruleError(ErrBadVersion, "%d", header.Version)
+	}
+
+	if header.ChainID != parent.ChainID {
+		return ruleError(ErrBadChainID, "%s", header.ChainID)
+	}
+
+	if header.Height != parent.Height+1 {
+		return ruleError(ErrBadHeight, "got %d, parent is %d", header.Height, parent.Height)
+	}
+
+	if header.Timestamp < parent.Timestamp {
+		return ruleError(ErrBadTimestamp, "got %d, parent is %d", header.Timestamp, parent.Timestamp)
+	}
+
+	return nil
+}
+
+//ValidateGenesis checks a genesis block made by another node. It has no parent
+//and only holds coinbase transactions
+func ValidateGenesis(block *Block) error {
+	if block.Height != 0 || len(block.PrevHash) != 0 || block.Version != BlockVersion {
+		return ruleError(ErrBadGenesis, "%x", block.Hash)
+	}
+
+	if len(block.Transaction) == 0 {
+		return ruleError(ErrNoTransactions, "%x", block.Hash)
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ruleError(ErrBadMerkleRoot, "%x", block.Hash)
+	}
+
+	if !bytes.Equal(block.Hash, block.BlockHashing()) {
+		return ruleError(ErrBadBlockHash, "%x", block.Hash)
+	}
+
+	for _, tx := range block.Transaction {
+		if !tx.IsCoinbase() {
+			return ruleError(ErrBadCoinbase, "%x", tx.ID)
+		}
+		if !bytes.Equal(tx.ID, tx.Hash()) {
+			return ruleError(ErrBadTxID, "%x", tx.ID)
+		}
+	}
+
+	return nil
+}
+
+//checkCoinbase checks that the coinbase pays exactly reward, the block
+//subsidy plus the fees of the block
+func checkCoinbase(block *Block, reward int) error {
+	paid := 0
+	for _, out := range block.Transaction[0].Outputs {
+		if out.Value < 0 {
+			return ruleError(ErrBadValue, "%x", block.Transaction[0].ID)
+		}
+		paid += out.Value
+	}
+	if paid != reward {
+		return ruleError(ErrBadReward, "got %d, want %d", paid, reward)
+	}
+
+	return nil
+}
+
+func checkDoubleSpend(block *Block) error {
+	spent := make(map[string]bool)
+
+	for _, tx := range block.Transaction {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			outpoint := fmt.Sprintf("%x:%d", in.ID, in.Out)
+			if spent[outpoint] {
+				return ruleError(ErrDoubleSpend, outpoint)
+			}
+			spent[outpoint] = true
+		}
+	}
+
+	return nil
+}
+
+//checkTransaction checks the rules of tx that do not need the transactions
+//it spends
+func checkTransaction(tx *Transaction) error {
+	for i, out := range tx.Outputs {
+		if len(out.Script) == 0 {
+			continue
+		}
+		if err := checkScript(out.Script); err != nil {
+			return ruleError(ErrBadScript, "%x:%d: %s", tx.ID, i, err)
+		}
+		if !bytes.Equal(out.PubKeyHash, wallet.PublicKeyHash(out.Script)) {
+			return ruleError(ErrBadScript, "%x:%d is not indexed by the hash of its script", tx.ID, i)
+		}
+	}
+	if err := checkDataOutputs(tx); err != nil {
+		return err
+	}
+	//a transaction spending nothing could be repeated by anyone for free
+	if !tx.IsCoinbase() && len(tx.Inputs) == 0 {
+		return ruleError(ErrNoInputs, "%x", tx.ID)
+	}
+
+	return nil
+}
+
+//verifyBlockTransaction is VerifyTransaction against the UTXO state of txn
+//that also looks for previous transactions earlier in the same block. It
+//returns the fee of tx, what its inputs hold beyond its outputs. Lock times
+//are left to the caller
+func (chain *Blockchain) verifyBlockTransaction(txn StoreTxn, tx *Transaction, blockTxs map[string]Transaction, ctx *spendContext) (int, error) {
+	if err := checkTransaction(tx); err != nil {
+		return 0, err
+	}
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	prevTxs := make(map[string]Transaction)
+	//entries are the UTXO entries of the previous transactions, the ones of
+	//the block or the pool count as confirmed by it
+	entries := make(map[string]TxOutputs)
+
+	for _, in := range tx.Inputs {
+		id := hex.EncodeToString(in.ID)
+		if prevTx, ok := blockTxs[id]; ok {
+			prevTxs[id] = prevTx
+			entries[id] = TxOutputs{Height: ctx.height, Coinbase: prevTx.IsCoinbase()}
+		} else if out, ok := prevOutput(in, prevTxs); !ok || out.PubKeyHash == nil {
+			prevTx, outs, err := utxoTransaction(txn, in)
+			if err != nil {
+				return 0, err
+			}
+			prevTxs[id] = prevTx
+			entries[id] = outs
+		}
+
+		if !ctx.matured(entries[id]) {
+			return 0, ruleError(ErrImmatureSpend, "%x:%d", in.ID, in.Out)
+		}
+	}
+
+	for _, in := range tx.Inputs {
+		if prevOut, ok := prevOutput(in, prevTxs); ok && prevOut.IsData() {
+			return 0, ruleError(ErrMissingInput, "%x:%d is a data output", in.ID, in.Out)
+		}
+	}
+
+	ages := make(map[string]int)
+	for id, outs := range entries {
+		ages[id] = ctx.height - outs.Height
+	}
+	if err := tx.Verify(prevTxs, ages); err != nil {
+		return 0, ruleError(ErrBadSignature, "%x: %s", tx.ID, err)
+	}
+
+	for _, in := range tx.Inputs {
+		prevOut, _ := prevOutput(in, prevTxs)
+		if !ctx.canSpend(entries[hex.EncodeToString(in.ID)], prevOut) {
+			return 0, ruleError(ErrRelativeLock, "%x:%d is locked for %d blocks", in.ID, in.Out, prevOut.LockBlocks)
+		}
+	}
+
+	return tx.Fee(prevTxs)
+}
+
+//matured tells whether the block of ctx can spend the outputs of outs as far
+//as coinbase maturity goes. The genesis block is spendable right away
+func (ctx *spendContext) matured(outs TxOutputs) bool {
+	return !outs.Coinbase || outs.Height == 0 || ctx.height-outs.Height >= ctx.maturity
+}
+
+//canSpend tells whether the block of ctx can spend out of outs, as far as
+//coinbase maturity and lock blocks go
+func (ctx *spendContext) canSpend(outs TxOutputs, out TxOutput) bool {
+	return ctx.matured(outs) && ctx.height-outs.Height >= out.LockBlocks
+}
+
+//nextSpendContext is the spendContext of the block after the tip, forged now
+func (chain *Blockchain) nextSpendContext() (*spendContext, error) {
+	var ctx *spendContext
+
+	err := chain.Database.View(func(txn StoreTxn) error {
+		var err error
+		ctx, err = chain.tipSpendContext(txn)
+		return err
+	})
+
+	return ctx, err
+}
+
+//tipSpendContext is nextSpendContext for the tip of txn
+func (chain *Blockchain) tipSpendContext(txn StoreTxn) (*spendContext, error) {
+	lastHash, err := getTip(txn)
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := getBlock(txn, lastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spendContext{tip.Height + 1, time.Now().Unix(), chain.Config.Params.CoinbaseMaturity}, nil
+}
@@ -1,11 +1,15 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/test-blockchain/blockchain"
 	"github.com/test-blockchain/network"
@@ -21,15 +25,39 @@ type (
 func (cli *CommandLine) printUsage() {
 	fmt.Println()
 	fmt.Println("Print Usage :")
-	fmt.Println("getBalance - address ADDRESS - get balance for the ADDRESS")
+	fmt.Println("getBalance - address ADDRESS [-light] - get balance for the ADDRESS, -light reads what a light node verified")
 	fmt.Println("createblockchain - address ADDRESS - create blockchain for the ADDRESS")
-	fmt.Println("send -from SENDER -to RECEIVER -amount AMOUNT - send amount from Sender to Receiver")
+	fmt.Println("createblockchain -genesis FILE - create blockchain from the genesis file FILE")
+	fmt.Println("send -from SENDER -to RECEIVER -amount AMOUNT [-fee FEE] [-locktime LOCKTIME] [-lockblocks BLOCKS] - send amount from Sender to Receiver, paying FEE to the forger")
+	fmt.Println("bumpfee -txid TXID -fee FEE -change INDEX - replaces a pending transaction of the wallet with one paying FEE, taken from its output INDEX")
+	fmt.Println("send -from SENDER -script SCRIPT -amount AMOUNT [-fee FEE] - locks amount with SCRIPT instead of paying an address")
+	fmt.Println("send -from SENDER -data DATA [-to RECEIVER -amount AMOUNT] [-fee FEE] - anchors the hex DATA in an output nobody can spend")
+	fmt.Println("spendscript -txid TXID -out N -unlock DATA -to RECEIVER [-fee FEE] [-locktime LOCKTIME] - spends an output locked by a script, sig:ADDRESS in DATA is replaced by a signature of the wallet")
+	fmt.Println("createmultisig -m M -keys KEY,KEY,... - creates the address of outputs M of the KEYs unlock, a KEY is a public key or a wallet address")
+	fmt.Println("getpubkey -address ADDRESS - prints the public key of a wallet address to share with co-signers")
+	fmt.Println("signtx -tx TX - adds the signatures of the wallet to a multisig transaction made by send")
+	fmt.Println("broadcast -tx TX - sends a multisig transaction with all its signatures")
 	fmt.Println("staketx -from SENDER -amount AMOUNT - send StakeTx to compete for forging block")
 	fmt.Println("printchain - prints the block in the chain")
+	fmt.Println("getblock -height HEIGHT | -hash HASH - prints the block at HEIGHT on the main chain or with HASH")
 	fmt.Println("createwallet - Create new wallet")
 	fmt.Println("listaddress - list addresses in our wallet")
 	fmt.Println("reindexutxo - Rebuilds the UTXO set")
+	fmt.Println("reindextx - Builds the transaction index and keeps it updated")
+	fmt.Println("migratedb - Re-encodes blocks stored with gob in the canonical encoding")
+	fmt.Println("exportchain -file FILE [-start HEIGHT] [-end HEIGHT] - writes the main chain blocks to FILE")
+	fmt.Println("importchain -file FILE [-genesis FILE] - validates and adds the blocks of FILE, creating the chain if needed")
+	fmt.Println("snapshot -file FILE [-height HEIGHT] - writes the UTXO set at HEIGHT, the tip by default, to FILE")
+	fmt.Println("fetchsnapshot -file FILE [-height HEIGHT] - asks the first known node for a snapshot and writes it to FILE")
+	fmt.Println("loadsnapshot -file FILE [-hash HASH] - creates the chain from a snapshot, HASH is the snapshot hash you trust")
+	fmt.Println("prune -keep N - keeps only the latest N blocks from now on, 0 keeps every block again")
+	fmt.Println("history -address ADDRESS -limit LIMIT [-cursor CURSOR] - lists the transactions of ADDRESS, newest first, below CURSOR printed with the previous page")
+	fmt.Println("history -address ADDRESS -page PAGE -limit LIMIT -light - lists the transactions of ADDRESS a light node verified, newest first")
+	fmt.Println("gettx -txid TXID - prints a transaction with its block and confirmations")
+	fmt.Println("getproof -txid TXID - prints the merkle proof that a transaction is in its block")
+	fmt.Println("getdata -data DATA - lists the transactions that anchored the hex DATA, earliest first")
 	fmt.Println("startnode -forger ADDRESS - Start a node with specific id in NODE_ID env. -forget enables forge blocks candidate")
+	fmt.Println("startnode -light [-genesis FILE | -genesishash HASH] - Start a light node that syncs headers and verifies the transactions of the wallet addresses, from the genesis block of FILE or with HASH")
 }
 
 func (cli *CommandLine) validateArgs() {
@@ -40,25 +68,66 @@ func (cli *CommandLine) validateArgs() {
 }
 
 func (cli *CommandLine) printChain(NodeId string) {
-	chain := blockchain.NormalBlockchainProcess(NodeId)
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
 	defer chain.Database.Close()
 	iter := chain.Iterate()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			log.Panic(err)
+		}
 
 		for _, tx := range block.Transaction {
 			fmt.Println(tx)
 		}
 		fmt.Println()
 
-		if len(block.PrevHash) == 0 {
+		if iter.Done() {
 			break
 		}
 
 	}
 }
 
+func (cli *CommandLine) getBlock(NodeId string, height int, hash string) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	var block blockchain.Block
+
+	if hash != "" {
+		blockHash, decodeErr := hex.DecodeString(hash)
+		if decodeErr != nil {
+			log.Panic(decodeErr)
+		}
+		block, err = chain.GetBlock(blockHash)
+	} else {
+		block, err = chain.GetBlockByHeight(height)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Hash:        %x\n", block.Hash)
+	fmt.Printf("Version:     %d\n", block.Version)
+	fmt.Printf("Chain ID:    %s\n", block.ChainID)
+	fmt.Printf("Prev Hash:   %x\n", block.PrevHash)
+	fmt.Printf("Merkle Root: %x\n", block.MerkleRoot)
+	fmt.Printf("Height:      %d\n", block.Height)
+	fmt.Printf("Validator:   %s\n", block.Validator)
+	fmt.Printf("Timestamp:   %d\n", block.Timestamp)
+	for _, tx := range block.Transaction {
+		fmt.Println(tx)
+	}
+}
+
 func (cli *CommandLine) Run() {
 	cli.validateArgs()
 
@@ -71,23 +140,94 @@ func (cli *CommandLine) Run() {
 	getBalanceCmd := flag.NewFlagSet("getBalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createBlockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	bumpFeeCmd := flag.NewFlagSet("bumpfee", flag.ExitOnError)
+	spendScriptCmd := flag.NewFlagSet("spendscript", flag.ExitOnError)
+	createMultisigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	signTxCmd := flag.NewFlagSet("signtx", flag.ExitOnError)
+	broadcastCmd := flag.NewFlagSet("broadcast", flag.ExitOnError)
 	stakeTxCmd := flag.NewFlagSet("stakeTx", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createNewWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	getAllWalletAddressCmd := flag.NewFlagSet("getaddress", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	migrateDBCmd := flag.NewFlagSet("migratedb", flag.ExitOnError)
+	exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+	importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
+	snapshotCmd := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fetchSnapshotCmd := flag.NewFlagSet("fetchsnapshot", flag.ExitOnError)
+	loadSnapshotCmd := flag.NewFlagSet("loadsnapshot", flag.ExitOnError)
+	pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+	getTxCmd := flag.NewFlagSet("gettx", flag.ExitOnError)
+	getProofCmd := flag.NewFlagSet("getproof", flag.ExitOnError)
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	getDataCmd := flag.NewFlagSet("getdata", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "the address of ownder")
+	getBalanceLight := getBalanceCmd.Bool("light", false, "Read the balance verified by the light node")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "the address of the blockchain maker")
+	createBlockchainGenesis := createBlockchainCmd.String("genesis", "", "Genesis file of the chain")
 	sendFrom := sendCmd.String("from", "", "Source wallet addres")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee paid to the forger of the block")
+	sendLockTime := sendCmd.Int64("locktime", 0, "Height, or unix time from 500000000, the transaction can be forged at")
+	sendLockBlocks := sendCmd.Int("lockblocks", 0, "Blocks the Receiver waits after the transaction is forged to spend the amount")
+	sendScript := sendCmd.String("script", "", "Script locking the amount instead of the Receiver address")
+	sendData := sendCmd.String("data", "", "Hex encoded data to anchor, at most 80 bytes")
+
+	spendScriptTxID := spendScriptCmd.String("txid", "", "ID of the transaction of the output")
+	spendScriptOut := spendScriptCmd.Int("out", 0, "Index of the output in the transaction")
+	spendScriptUnlock := spendScriptCmd.String("unlock", "", "Unlocking data pushed before the script runs")
+	spendScriptTo := spendScriptCmd.String("to", "", "Destination wallet address")
+	spendScriptFee := spendScriptCmd.Int("fee", 0, "Fee paid to the forger of the block")
+	spendScriptLockTime := spendScriptCmd.Int64("locktime", 0, "Lock time of the transaction, for scripts checking it")
+
+	bumpFeeTxID := bumpFeeCmd.String("txid", "", "ID of the pending transaction")
+	bumpFeeFee := bumpFeeCmd.Int("fee", 0, "New fee, above the one of the pending transaction")
+	bumpFeeChange := bumpFeeCmd.Int("change", -1, "Index of the change output of the pending transaction, -1 when it has none")
+
+	createMultisigM := createMultisigCmd.Int("m", 0, "Signatures needed to spend")
+	createMultisigKeys := createMultisigCmd.String("keys", "", "Comma separated public keys or wallet addresses of the co-signers")
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "Wallet address")
+	signTxTx := signTxCmd.String("tx", "", "Hex encoded transaction")
+	broadcastTx := broadcastCmd.String("tx", "", "Hex encoded transaction")
 
 	stakeTxFrom := stakeTxCmd.String("from", "", "Source wallet addres")
 	stakeTxAmount := stakeTxCmd.Int("amount", 0, "Amount to send")
 
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the block on the main chain")
+	getBlockHash := getBlockCmd.String("hash", "", "Hash of the block")
+
+	getTxID := getTxCmd.String("txid", "", "ID of the transaction")
+	exportFile := exportChainCmd.String("file", "", "File to write the blocks to")
+	exportStart := exportChainCmd.Int("start", 0, "Height of the first block to export")
+	exportEnd := exportChainCmd.Int("end", -1, "Height of the last block to export, the tip by default")
+	importFile := importChainCmd.String("file", "", "File to read the blocks from")
+	importGenesis := importChainCmd.String("genesis", "", "Genesis file the chain has to start from")
+	snapshotFile := snapshotCmd.String("file", "", "File to write the snapshot to")
+	snapshotHeight := snapshotCmd.Int("height", -1, "Height of the snapshot, the tip by default")
+	fetchSnapshotFile := fetchSnapshotCmd.String("file", "", "File to write the snapshot to")
+	fetchSnapshotHeight := fetchSnapshotCmd.Int("height", -1, "Height of the snapshot, the tip by default")
+	loadSnapshotFile := loadSnapshotCmd.String("file", "", "File to read the snapshot from")
+	loadSnapshotHash := loadSnapshotCmd.String("hash", "", "Hash the snapshot must have")
+	pruneKeep := pruneCmd.Int("keep", -1, "How many of the latest blocks to keep, 0 keeps every block")
+	getProofTxID := getProofCmd.String("txid", "", "ID of the transaction")
+	historyAddress := historyCmd.String("address", "", "the address of owner")
+	historyPage := historyCmd.Int("page", 0, "Page to show with -light, starting from 0")
+	historyCursor := historyCmd.String("cursor", "", "Cursor of the page to show, printed with the previous page")
+	historyLimit := historyCmd.Int("limit", 10, "Transactions per page")
+	historyLight := historyCmd.Bool("light", false, "Read the history verified by the light node")
+	getDataData := getDataCmd.String("data", "", "Hex encoded data")
+
 	startNodeAddress := startNodeCmd.String("address", "", "Enable forger mode to send reward to ADDRESS")
-	startNodeTimeForge := startNodeCmd.Uint64("timeforge", 0, "Enable mining mode and send reward to ADDRESS")
+	startNodeTimeForge := startNodeCmd.Uint64("timeforge", 0, "Seconds between forged blocks, the forge interval of the genesis file by default")
+	startNodeLight := startNodeCmd.Bool("light", false, "Only sync headers and verify the transactions of the wallet addresses")
+	startNodeGenesis := startNodeCmd.String("genesis", "", "Genesis file of the chain a light node syncs")
+	startNodeGenesisHash := startNodeCmd.String("genesishash", "", "Hash of the genesis block of the chain a light node syncs")
 
 	switch os.Args[1] {
 	case "getbalance":
@@ -96,6 +236,24 @@ func (cli *CommandLine) Run() {
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		blockchain.Handler(err)
+	case "bumpfee":
+		err := bumpFeeCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "spendscript":
+		err := spendScriptCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "createmultisig":
+		err := createMultisigCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "getpubkey":
+		err := getPubKeyCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "signtx":
+		err := signTxCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "broadcast":
+		err := broadcastCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
 	case "staketx":
 		err := stakeTxCmd.Parse(os.Args[2:])
 		blockchain.Handler(err)
@@ -111,6 +269,48 @@ func (cli *CommandLine) Run() {
 	case "createwallet":
 		err := createNewWalletCmd.Parse(os.Args[2:])
 		blockchain.Handler(err)
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "migratedb":
+		err := migrateDBCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "exportchain":
+		err := exportChainCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "importchain":
+		err := importChainCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "snapshot":
+		err := snapshotCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "fetchsnapshot":
+		err := fetchSnapshotCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "loadsnapshot":
+		err := loadSnapshotCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "prune":
+		err := pruneCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "gettx":
+		err := getTxCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "getproof":
+		err := getProofCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "history":
+		err := historyCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
+	case "getdata":
+		err := getDataCmd.Parse(os.Args[2:])
+		blockchain.Handler(err)
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -133,13 +333,121 @@ func (cli *CommandLine) Run() {
 		cli.listWalletAddress(nodeID)
 	}
 
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO(nodeID)
+	}
+
+	if getBlockCmd.Parsed() {
+		if *getBlockHeight < 0 && *getBlockHash == "" {
+			getBlockCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getBlock(nodeID, *getBlockHeight, *getBlockHash)
+	}
+
+	if reindexTxCmd.Parsed() {
+		cli.reindexTx(nodeID)
+	}
+
+	if migrateDBCmd.Parsed() {
+		cli.migrateDB(nodeID)
+	}
+
+	if exportChainCmd.Parsed() {
+		if *exportFile == "" || *exportStart < 0 {
+			exportChainCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.exportChain(nodeID, *exportFile, *exportStart, *exportEnd)
+	}
+
+	if importChainCmd.Parsed() {
+		if *importFile == "" {
+			importChainCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importChain(nodeID, *importFile, *importGenesis)
+	}
+
+	if snapshotCmd.Parsed() {
+		if *snapshotFile == "" {
+			snapshotCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.snapshot(nodeID, *snapshotFile, *snapshotHeight)
+	}
+
+	if fetchSnapshotCmd.Parsed() {
+		if *fetchSnapshotFile == "" {
+			fetchSnapshotCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.fetchSnapshot(nodeID, *fetchSnapshotFile, *fetchSnapshotHeight)
+	}
+
+	if loadSnapshotCmd.Parsed() {
+		if *loadSnapshotFile == "" {
+			loadSnapshotCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.loadSnapshot(nodeID, *loadSnapshotFile, *loadSnapshotHash)
+	}
+
+	if pruneCmd.Parsed() {
+		if *pruneKeep < 0 {
+			pruneCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.prune(nodeID, *pruneKeep)
+	}
+
+	if getTxCmd.Parsed() {
+		if *getTxID == "" {
+			getTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getTx(nodeID, *getTxID)
+	}
+
+	if getProofCmd.Parsed() {
+		if *getProofTxID == "" {
+			getProofCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getProof(nodeID, *getProofTxID)
+	}
+
+	if historyCmd.Parsed() {
+		if *historyAddress == "" || *historyPage < 0 || *historyLimit <= 0 {
+			historyCmd.Usage()
+			runtime.Goexit()
+		}
+		if *historyLight {
+			cli.lightHistory(*historyAddress, nodeID, *historyPage, *historyLimit)
+		} else {
+			cli.history(*historyAddress, nodeID, *historyCursor, *historyLimit)
+		}
+	}
+
+	if getDataCmd.Parsed() {
+		if *getDataData == "" {
+			getDataCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getData(nodeID, *getDataData)
+	}
+
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
 			runtime.Goexit()
 		}
 
-		cli.getBalance(*getBalanceAddress, nodeID)
+		if *getBalanceLight {
+			cli.lightBalance(*getBalanceAddress, nodeID)
+		} else {
+			cli.getBalance(*getBalanceAddress, nodeID)
+		}
 	}
 	if startNodeCmd.Parsed() {
 		nodeID := os.Getenv("NODE_ID")
@@ -147,15 +455,83 @@ func (cli *CommandLine) Run() {
 			startNodeCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.startNode(nodeID, *startNodeAddress, *startNodeTimeForge)
+		if *startNodeLight {
+			if *startNodeGenesis != "" && *startNodeGenesisHash != "" {
+				startNodeCmd.Usage()
+				runtime.Goexit()
+			}
+			cli.startLightNode(nodeID, *startNodeGenesis, *startNodeGenesisHash)
+		} else {
+			cli.startNode(nodeID, *startNodeAddress, *startNodeTimeForge)
+		}
 	}
 
-	if sendCmd.Parsed() {
+	if sendCmd.Parsed() && *sendScript != "" {
+		if *sendFrom == "" {
+			sendCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendScript(*sendFrom, *sendScript, nodeID, *sendAmount, *sendFee)
+	} else if sendCmd.Parsed() && *sendData != "" {
+		if *sendFrom == "" {
+			sendCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendData(*sendFrom, *sendTo, *sendData, nodeID, *sendAmount, *sendFee)
+	} else if sendCmd.Parsed() {
 		if *sendFrom == "" || *sendTo == "" {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.send(*sendFrom, *sendTo, nodeID, *sendAmount)
+		cli.send(*sendFrom, *sendTo, nodeID, *sendAmount, *sendFee, *sendLockTime, *sendLockBlocks)
+	}
+
+	if bumpFeeCmd.Parsed() {
+		if *bumpFeeTxID == "" || *bumpFeeFee <= 0 || *bumpFeeChange < -1 {
+			bumpFeeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.bumpFee(nodeID, *bumpFeeTxID, *bumpFeeChange, *bumpFeeFee)
+	}
+
+	if spendScriptCmd.Parsed() {
+		if *spendScriptTxID == "" || *spendScriptTo == "" {
+			spendScriptCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.spendScript(nodeID, *spendScriptTxID, *spendScriptOut, *spendScriptUnlock, *spendScriptTo, *spendScriptFee, *spendScriptLockTime)
+	}
+
+	if createMultisigCmd.Parsed() {
+		if *createMultisigM <= 0 || *createMultisigKeys == "" {
+			createMultisigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createMultisig(nodeID, *createMultisigM, strings.Split(*createMultisigKeys, ","))
+	}
+
+	if getPubKeyCmd.Parsed() {
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getPubKey(nodeID, *getPubKeyAddress)
+	}
+
+	if signTxCmd.Parsed() {
+		if *signTxTx == "" {
+			signTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signTx(nodeID, *signTxTx)
+	}
+
+	if broadcastCmd.Parsed() {
+		if *broadcastTx == "" {
+			broadcastCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.broadcast(*broadcastTx)
 	}
 
 	if stakeTxCmd.Parsed() {
@@ -167,11 +543,15 @@ func (cli *CommandLine) Run() {
 	}
 
 	if createBlockchainCmd.Parsed() {
-		if *createBlockchainAddress == "" {
-			getBalanceCmd.Usage()
+		if (*createBlockchainAddress == "") == (*createBlockchainGenesis == "") {
+			createBlockchainCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.createBlockchain(*createBlockchainAddress, nodeID)
+		if *createBlockchainGenesis != "" {
+			cli.createBlockchainFromGenesis(*createBlockchainGenesis, nodeID)
+		} else {
+			cli.createBlockchain(*createBlockchainAddress, nodeID)
+		}
 	}
 }
 
@@ -179,127 +559,862 @@ func (cli *CommandLine) createBlockchain(address, NodeId string) {
 	if !wallet.ValidateAddress(address) {
 		log.Panic("Address is not valid!")
 	}
-	chain := blockchain.InitBlockchain(address, NodeId)
+	chain, err := blockchain.InitBlockchain(address, NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
 	defer chain.Database.Close()
 	fmt.Println("Finished!")
 }
 
-func (cli *CommandLine) getBalance(address, NodeId string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+func (cli *CommandLine) createBlockchainFromGenesis(file, NodeId string) {
+	config, err := blockchain.LoadGenesisConfig(file)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain, err := blockchain.InitBlockchainFromConfig(NodeId, config)
+	if err != nil {
+		log.Panic(err)
 	}
-	chain := blockchain.NormalBlockchainProcess(NodeId)
 	defer chain.Database.Close()
+	fmt.Printf("Finished! chain %s, genesis %x\n", config.ChainID, chain.LastHash)
+}
 
-	balance := 0
-	pubKeyHash := wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[:len(pubKeyHash)-4]
-	UTXOs := chain.FindUTXO(pubKeyHash)
+func (cli *CommandLine) reindexUTXO(NodeId string) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
 
-	for _, out := range UTXOs {
-		balance += out.Value
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		log.Panic(err)
 	}
 
-	fmt.Printf("Balance of %s: %d\n", address, balance)
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
 }
 
-//send function with param Sender, Receiver and Amount. to send normal sendTx function
-//fill all parameters
-//empty Receiver && Amount is a StakeTx
-func (cli *CommandLine) send(Sender, Receiver, NodeId string, amount int) {
-	if !wallet.ValidateAddress(Sender) {
-		log.Panic("Sender is not valid!")
+func (cli *CommandLine) reindexTx(NodeId string) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
 	}
-	if Receiver == "" {
-		log.Panic("Receiver is not valid!")
+	defer chain.Database.Close()
+
+	count, err := chain.ReindexTransactions()
+	if err != nil {
+		log.Panic(err)
 	}
+	fmt.Printf("Done! There are %d transactions in the transaction index.\n", count)
+}
 
-	chain := blockchain.NormalBlockchainProcess(NodeId)
+func (cli *CommandLine) migrateDB(NodeId string) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
 	defer chain.Database.Close()
 
-	wallets, err := wallet.CreateWallet(NodeId)
+	count, err := chain.MigrateStorage()
 	if err != nil {
 		log.Panic(err)
 	}
-	wallet := wallets.GetWalletFromAddress(Sender)
+	fmt.Printf("Done! %d blocks were re-encoded.\n", count)
+}
 
-	tx := blockchain.NewTransaction(&wallet, Sender, Receiver, amount, chain)
+//printProgress reports every 100th block of an export or import
+func printProgress(height int) {
+	if height%100 == 0 {
+		fmt.Printf("height %d\n", height)
+	}
+}
 
-	fmt.Println(tx)
+func (cli *CommandLine) exportChain(NodeId, file string, start, end int) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
 
-	network.SendTx(network.KnownNodes[0], tx)
-	fmt.Println("Transaction Proposal has been sent")
+	f, err := os.Create(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer f.Close()
 
-	//the normal transaction should be pushed to the txPool to be forged into one block later
+	count, err := chain.Export(f, start, end, printProgress)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! %d blocks were exported to %s.\n", count, file)
+}
 
-	//gonna change this later so that the winner of the PoS will get the rewards
-	//Generate random rewards, should be fees but not implemented
-	// randData := make([]byte, 24)
-	// _, err := rand.Read(randData)
-	// if err != nil {
-	// 	log.Panic(err)
-	// }
+func (cli *CommandLine) importChain(NodeId, file, genesisFile string) {
+	var config *blockchain.GenesisConfig
+	if genesisFile != "" {
+		var err error
+		if config, err = blockchain.LoadGenesisConfig(genesisFile); err != nil {
+			log.Panic(err)
+		}
+	}
 
-	// valueString := fmt.Sprintf("%x", randData)
-	// value, err := strconv.Atoi(valueString)
-	// if err != nil {
-	// 	log.Panic(err)
-	// }
+	f, err := os.Open(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer f.Close()
 
-	// cbTx := blockchain.CoinbaseTx(Sender, "", value)
+	reader, err := blockchain.NewExportReader(bufio.NewReader(f))
+	if err != nil {
+		log.Panic(err)
+	}
 
-	// chain.ForgeBlock([]*blockchain.Transaction{cbTx, tx}, Sender)
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	count := 0
+	if err == blockchain.ErrNoBlockchain {
+		chain, count, err = blockchain.ImportBlockchain(NodeId, reader, config, printProgress)
+	} else if err == nil {
+		count, err = chain.Import(reader, printProgress)
+	}
+	if chain != nil {
+		defer chain.Database.Close()
+	}
+	if err != nil {
+		log.Panic(err)
+	}
 
-	fmt.Println("Success!")
+	height, err := chain.GetLastHeight()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! %d blocks were imported, the chain is at height %d.\n", count, height)
 }
 
-func (cli *CommandLine) sendStake(Sender, NodeId string, amount int) {
-	if !wallet.ValidateAddress(Sender) {
-		log.Panic("Sender is not valid!")
+func (cli *CommandLine) prune(NodeId string, keep int) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
 	}
-
-	chain := blockchain.NormalBlockchainProcess(NodeId)
 	defer chain.Database.Close()
 
-	wallets, err := wallet.CreateWallet(NodeId)
-
+	count, err := chain.SetPruning(keep)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	wallet := wallets.GetWalletFromAddress(Sender)
-
-	tx := blockchain.NewTransaction(&wallet, Sender, "", amount, chain)
+	if keep == 0 {
+		fmt.Printf("Done! pruning is off, blocks below %d stay pruned.\n", chain.Base)
+	} else {
+		fmt.Printf("Done! %d blocks were pruned, blocks from %d are kept.\n", count, chain.Base)
+	}
+}
 
-	fmt.Println(tx)
+func printSnapshot(s *blockchain.Snapshot) {
+	fmt.Printf("Height:     %d\n", s.Height)
+	fmt.Printf("Block Hash: %x\n", s.BlockHash)
+	fmt.Printf("Hash:       %x\n", s.Hash)
+	fmt.Printf("UTXOs:      %d transactions\n", len(s.UTXOs))
+}
 
-	//after we make the transaction proposal, we sent it
+func (cli *CommandLine) snapshot(NodeId, file string, height int) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
 
-	cbTx := blockchain.CoinbaseTx(Sender, "", amount)
-	network.SendStakeTx(network.KnownNodes[0], cbTx)
-	fmt.Println("Transaction Proposal has been sent")
+	snapshot, err := chain.Snapshot(height)
+	if err != nil {
+		log.Panic(err)
+	}
 
-	fmt.Println("Success!")
+	if err := ioutil.WriteFile(file, snapshot.Serialize(), 0644); err != nil {
+		log.Panic(err)
+	}
+	printSnapshot(snapshot)
 }
 
-func (cli *CommandLine) listWalletAddress(NodeID string) {
-	wallets, _ := wallet.CreateWallet(NodeID)
-	addresses := wallets.GetAllAddressFromWallet()
+func (cli *CommandLine) fetchSnapshot(NodeId, file string, height int) {
+	snapshot, err := network.FetchSnapshot(NodeId, height)
+	if err != nil {
+		log.Panic(err)
+	}
 
-	for _, address := range addresses {
-		fmt.Println(address)
+	if err := ioutil.WriteFile(file, snapshot.Serialize(), 0644); err != nil {
+		log.Panic(err)
 	}
+	printSnapshot(snapshot)
 }
 
-func (cli *CommandLine) createWallet(NodeId string) {
-	wallets, _ := wallet.CreateWallet(NodeId)
-	address := wallets.AddNewWallet()
-	wallets.SaveFile(NodeId)
-
-	fmt.Printf("New address is %s\n", address)
-}
+func (cli *CommandLine) loadSnapshot(NodeId, file, hash string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
 
-func (cli *CommandLine) startNode(NodeID, Address string, forgeTime uint64) {
+	snapshot, err := blockchain.DeserializeSnapshot(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if hash != "" && hash != hex.EncodeToString(snapshot.Hash) {
+		log.Panicf("Snapshot hash is %x, not %s", snapshot.Hash, hash)
+	}
+
+	chain, err := blockchain.InitBlockchainFromSnapshot(NodeId, snapshot)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	printSnapshot(snapshot)
+	fmt.Println("Done! start the node to sync the blocks after the snapshot.")
+}
+
+func (cli *CommandLine) getTx(NodeId, txID string) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if !chain.HasTxIndex() {
+		fmt.Println("transaction index is not built, scanning the chain. run reindextx to build it")
+	}
+
+	info, err := chain.GetTransaction(ID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(info.Transaction)
+	fmt.Printf("Block:         %x\n", info.BlockHash)
+	fmt.Printf("Height:        %d\n", info.Height)
+	fmt.Printf("Confirmations: %d\n", info.Confirmations)
+}
+
+//getData prints the main chain transactions that anchored the hex encoded data
+func (cli *CommandLine) getData(NodeId, data string) {
+	payload, err := hex.DecodeString(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	anchors, err := chain.GetDataAnchors(payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(anchors) == 0 {
+		fmt.Println("data is not anchored on the main chain")
+		return
+	}
+	for _, anchor := range anchors {
+		fmt.Printf("%x  block %x  height %d  time %d\n", anchor.TxID, anchor.BlockHash, anchor.Height, anchor.Timestamp)
+	}
+}
+
+func (cli *CommandLine) getProof(NodeId, txID string) {
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	proof, err := chain.GetTxProof(ID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Block:       %x\n", proof.BlockHash)
+	fmt.Printf("Height:      %d\n", proof.Header.Height)
+	fmt.Printf("Merkle Root: %x\n", proof.Header.MerkleRoot)
+	fmt.Printf("Index:       %d\n", proof.Proof.Index)
+	for _, hash := range proof.Proof.Hashes {
+		fmt.Printf("  %x\n", hash)
+	}
+	fmt.Printf("Valid:       %t\n", proof.Verify())
+}
+
+func (cli *CommandLine) getBalance(address, NodeId string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is not Valid")
+	}
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	balance := 0
+	pubKeyHash, err := wallet.AddressToPubKeyHash(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	UTXOs, err := UTXOSet.FindUTXO(pubKeyHash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	fmt.Printf("Balance of %s: %d\n", address, balance)
+}
+
+//history prints the transactions of address below cursor, and the cursor of
+//the next page
+func (cli *CommandLine) history(address, NodeId, cursor string, limit int) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is not Valid")
+	}
+	from, err := hex.DecodeString(cursor)
+	if err != nil {
+		log.Panic(err)
+	}
+	if cursor == "" {
+		from = nil
+	}
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	pubKeyHash, err := wallet.AddressToPubKeyHash(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	history, next, err := chain.GetAddressHistory(pubKeyHash, from, limit)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("History of %s: %d transactions\n", address, len(history))
+	for _, entry := range history {
+		kind := "transfer"
+		if entry.Coinbase {
+			kind = "coinbase"
+		}
+		fmt.Printf("%x  height %d  time %d  %-8s  %+d\n", entry.TxID, entry.Height, entry.Timestamp, kind, entry.Amount)
+	}
+	if next != nil {
+		fmt.Printf("Next page: -cursor %x\n", next)
+	}
+}
+
+func (cli *CommandLine) lightBalance(address, NodeId string) {
+	pubKeyHash, err := wallet.AddressToPubKeyHash(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	headers, err := blockchain.LoadHeaderChain(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer headers.Database.Close()
+
+	balance, err := headers.Balance(pubKeyHash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Verified balance of %s: %d\n", address, balance)
+}
+
+func (cli *CommandLine) lightHistory(address, NodeId string, page, limit int) {
+	pubKeyHash, err := wallet.AddressToPubKeyHash(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	headers, err := blockchain.LoadHeaderChain(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer headers.Database.Close()
+
+	history, err := headers.History(pubKeyHash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Verified history of %s: %d transactions, page %d\n", address, len(history), page)
+	for i := page * limit; i < len(history) && i < (page+1)*limit; i++ {
+		entry := history[i]
+		kind := "transfer"
+		if entry.Coinbase {
+			kind = "coinbase"
+		}
+		fmt.Printf("%x  height %d  time %d  %-8s  %+d\n", entry.TxID, entry.Height, entry.Timestamp, kind, entry.Amount)
+	}
+}
+
+//send function with param Sender, Receiver and Amount. to send normal sendTx function
+//fill all parameters
+//empty Receiver && Amount is a StakeTx
+func (cli *CommandLine) send(Sender, Receiver, NodeId string, amount, fee int, lockTime int64, lockBlocks int) {
+	if !wallet.ValidateAddress(Sender) {
+		log.Panic("Sender is not valid!")
+	}
+	if Receiver == "" {
+		log.Panic("Receiver is not valid!")
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	if wallet.IsMultisigAddress(Sender) {
+		redeemScript, err := wallets.GetRedeemScript(Sender)
+		if err != nil {
+			log.Panic(err)
+		}
+		tx, err := blockchain.NewMultisigTransaction(redeemScript, Receiver, amount, fee, lockTime, lockBlocks, &UTXOSet)
+		if err != nil {
+			log.Panic(err)
+		}
+		signMultisig(chain, wallets, tx)
+
+		fmt.Println(tx)
+		fmt.Printf("Fee: %d\n", fee)
+		if tx.MissingSignatures() > 0 {
+			printPartial(tx)
+			return
+		}
+
+		network.SendTx(network.KnownNodes[0], tx)
+		fmt.Println("Transaction Proposal has been sent")
+		return
+	}
+
+	wallet, err := wallets.GetWalletFromAddress(Sender)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tx, err := blockchain.NewLockedTransaction(&wallet, Sender, Receiver, amount, fee, lockTime, lockBlocks, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("Fee: %d\n", fee)
+
+	network.SendTx(network.KnownNodes[0], tx)
+	fmt.Println("Transaction Proposal has been sent")
+
+	//the normal transaction is pushed to the txPool to be forged into one block
+	//later, the forger collects its fee
+
+	fmt.Println("Success!")
+}
+
+//sendScript locks amount from Sender with the script written as text, see
+//blockchain.AssembleScript
+func (cli *CommandLine) sendScript(Sender, text, NodeId string, amount, fee int) {
+	script, err := blockchain.AssembleScript(text)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallet, err := wallets.GetWalletFromAddress(Sender)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	tx, err := blockchain.NewScriptTransaction(&wallet, Sender, script, amount, fee, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("Fee: %d\n", fee)
+
+	network.SendTx(network.KnownNodes[0], tx)
+	fmt.Println("Transaction Proposal has been sent")
+
+	fmt.Println("Success!")
+}
+
+//sendData anchors the hex encoded data from Sender, paying amount to Receiver
+//too when it is set
+func (cli *CommandLine) sendData(Sender, Receiver, data, NodeId string, amount, fee int) {
+	payload, err := hex.DecodeString(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallet, err := wallets.GetWalletFromAddress(Sender)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	tx, err := blockchain.NewDataTransaction(&wallet, Sender, Receiver, amount, payload, fee, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("Fee: %d\n", fee)
+
+	network.SendTx(network.KnownNodes[0], tx)
+	fmt.Println("Transaction Proposal has been sent")
+
+	fmt.Println("Success!")
+}
+
+//spendScript sends an output locked by a script to Receiver. The words
+//sig:ADDRESS of the unlocking data are signatures of the wallet of ADDRESS
+func (cli *CommandLine) spendScript(NodeId, txID string, out int, text, Receiver string, fee int, lockTime int64) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+
+	unlock := func(sigHash []byte) ([]byte, error) {
+		words := strings.Fields(text)
+		for i, word := range words {
+			if !strings.HasPrefix(word, "sig:") {
+				continue
+			}
+			signer, err := wallets.GetWalletFromAddress(word[len("sig:"):])
+			if err != nil {
+				return nil, err
+			}
+			signature, err := wallet.Sign(&signer.PrivateKey, sigHash)
+			if err != nil {
+				return nil, err
+			}
+			words[i] = fmt.Sprintf("0x%x", signature)
+		}
+		return blockchain.AssembleScript(strings.Join(words, " "))
+	}
+
+	tx, err := blockchain.SpendScriptOutput(chain, id, out, Receiver, fee, lockTime, unlock)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("Fee: %d\n", fee)
+
+	network.SendTx(network.KnownNodes[0], tx)
+	fmt.Println("Transaction Proposal has been sent")
+
+	fmt.Println("Success!")
+}
+
+//createMultisig keeps the M of N address of keys in the wallet file so send
+//and signtx can use it. Every co-signer runs it with the same keys
+func (cli *CommandLine) createMultisig(NodeId string, m int, keys []string) {
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+
+	var pubKeys [][]byte
+	for _, key := range keys {
+		if w, err := wallets.GetWalletFromAddress(key); err == nil {
+			pubKeys = append(pubKeys, w.Publickey)
+			continue
+		}
+
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			log.Panicf("%s is neither a wallet address nor a public key", key)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	address, err := wallets.AddMultisig(m, pubKeys)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := wallets.SaveFile(NodeId); err != nil {
+		log.Panic(err)
+	}
+
+	redeemScript, _ := wallets.GetRedeemScript(address)
+	fmt.Printf("Redeem script: %x\n", redeemScript)
+	fmt.Printf("New %d of %d multisig address is %s\n", m, len(pubKeys), address)
+}
+
+func (cli *CommandLine) getPubKey(NodeId, address string) {
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallet, err := wallets.GetWalletFromAddress(address)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("%x\n", wallet.Publickey)
+}
+
+//signTx adds the signatures of the wallet keys to a multisig transaction and
+//prints it back, to pass on to the next co-signer or to broadcast
+func (cli *CommandLine) signTx(NodeId, data string) {
+	tx := decodeTx(data)
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	missing := tx.MissingSignatures()
+	signMultisig(chain, wallets, tx)
+	if tx.MissingSignatures() == missing {
+		log.Panic("no key of the wallet can add a signature to the transaction")
+	}
+
+	fmt.Println(tx)
+	if tx.MissingSignatures() > 0 {
+		printPartial(tx)
+		return
+	}
+
+	fmt.Println("The transaction has all its signatures, send it with:")
+	fmt.Printf("broadcast -tx %x\n", tx.Serialize())
+}
+
+func (cli *CommandLine) broadcast(data string) {
+	tx := decodeTx(data)
+	if missing := tx.MissingSignatures(); missing > 0 {
+		log.Panicf("the transaction needs %d more signatures", missing)
+	}
+
+	network.SendTx(network.KnownNodes[0], tx)
+	fmt.Println("Transaction Proposal has been sent")
+
+	fmt.Println("Success!")
+}
+
+//signMultisig signs tx with every key of wallets
+func signMultisig(chain *blockchain.Blockchain, wallets *wallet.Wallets, tx *blockchain.Transaction) {
+	for _, w := range wallets.Wallets {
+		if err := chain.SignTransaction(tx, w.PrivateKey); err != nil {
+			log.Panic(err)
+		}
+	}
+	tx.ID = tx.Hash()
+}
+
+func printPartial(tx *blockchain.Transaction) {
+	fmt.Printf("The transaction needs %d more signatures, pass it to the co-signers:\n", tx.MissingSignatures())
+	fmt.Printf("signtx -tx %x\n", tx.Serialize())
+}
+
+func decodeTx(data string) *blockchain.Transaction {
+	encoded, err := hex.DecodeString(data)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := blockchain.DeserializeTransaction(encoded)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return &tx
+}
+
+//bumpFee fetches a pending transaction from the first known node and sends a
+//replacement paying fee out of output change, which the pool takes in place
+//of the old one. The pending transactions it spends from are fetched too
+func (cli *CommandLine) bumpFee(NodeId, txID string, change, fee int) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	pending, err := network.FetchTransaction(NodeId, id)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallet, err := wallets.GetWalletFromAddress(pending.Inputs[0].SenderAddress)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	parents := make(map[string]blockchain.Transaction)
+	for _, in := range pending.Inputs {
+		unspent, err := UTXOSet.IsUnspent(in.ID, in.Out)
+		if err != nil {
+			log.Panic(err)
+		}
+		if _, ok := parents[hex.EncodeToString(in.ID)]; unspent || ok {
+			continue
+		}
+
+		parent, err := network.FetchTransaction(NodeId, in.ID)
+		if err != nil {
+			log.Panic(err)
+		}
+		parents[hex.EncodeToString(in.ID)] = *parent
+	}
+
+	tx, err := blockchain.BumpFee(&wallet, pending, parents, change, fee, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("Fee: %d\n", fee)
+
+	network.SendTx(network.KnownNodes[0], tx)
+	fmt.Println("Replacement has been sent")
+
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) sendStake(Sender, NodeId string, amount int) {
+	if !wallet.ValidateAddress(Sender) {
+		log.Panic("Sender is not valid!")
+	}
+
+	chain, err := blockchain.NormalBlockchainProcess(NodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallet(NodeId)
+
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallet, err := wallets.GetWalletFromAddress(Sender)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	//the stake is paid back to the sender, it proves the sender holds amount
+	//without minting anything
+	tx, err := blockchain.NewTransaction(&wallet, Sender, Sender, amount, 0, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+
+	//after we make the transaction proposal, we sent it
+	network.SendStakeTx(network.KnownNodes[0], tx)
+	fmt.Println("Transaction Proposal has been sent")
+
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) listWalletAddress(NodeID string) {
+	wallets, _ := wallet.CreateWallet(NodeID)
+	addresses := wallets.GetAllAddressFromWallet()
+
+	for _, address := range addresses {
+		fmt.Println(address)
+	}
+	for _, address := range wallets.GetMultisigAddresses() {
+		fmt.Println(address)
+	}
+}
+
+func (cli *CommandLine) createWallet(NodeId string) {
+	wallets, _ := wallet.CreateWallet(NodeId)
+	address, err := wallets.AddNewWallet()
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := wallets.SaveFile(NodeId); err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("New address is %s\n", address)
+}
+
+func (cli *CommandLine) startNode(NodeID, Address string, forgeTime uint64) {
 	fmt.Printf("Starting Node :%s\n", NodeID)
 
 	if len(Address) == 0 {
@@ -308,15 +1423,47 @@ func (cli *CommandLine) startNode(NodeID, Address string, forgeTime uint64) {
 
 	if len(Address) > 0 {
 		if wallet.ValidateAddress(Address) {
-			fmt.Println("Forging priviledge is activated. address to receive rewards : %s", Address)
+			fmt.Printf("Forging priviledge is activated. address to receive rewards : %s\n", Address)
 		} else {
 			log.Panic("Wrong Forger address")
 		}
 	}
 
-	if forgeTime == 0 {
-		forgeTime = uint64(30)
+	network.StartServer(NodeID, Address, forgeTime)
+}
+
+//startLightNode starts a light node whose headers start from the genesis
+//block of genesisFile or with hash genesisHash. Without either it keeps the
+//genesis header it synced before
+func (cli *CommandLine) startLightNode(NodeID, genesisFile, genesisHash string) {
+	fmt.Printf("Starting Light Node :%s\n", NodeID)
+
+	var genesis []byte
+	if genesisFile != "" {
+		config, err := blockchain.LoadGenesisConfig(genesisFile)
+		if err != nil {
+			log.Panic(err)
+		}
+		block, err := config.Block()
+		if err != nil {
+			log.Panic(err)
+		}
+		genesis = block.Hash
+	} else if genesisHash != "" {
+		var err error
+		if genesis, err = hex.DecodeString(genesisHash); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	wallets, err := wallet.CreateWallet(NodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	addresses := append(wallets.GetAllAddressFromWallet(), wallets.GetMultisigAddresses()...)
+	if len(addresses) == 0 {
+		log.Panic("no address in the wallet to watch")
 	}
 
-	network.StartServer(NodeID, Address, forgeTime)
+	network.StartLightNode(NodeID, genesis, addresses)
 }
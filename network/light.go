@@ -0,0 +1,260 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/test-blockchain/blockchain"
+	"github.com/test-blockchain/wallet"
+	"gopkg.in/vrecan/death.v3"
+)
+
+type (
+	//GetAddrTxs asks a full node for the transactions of some addresses
+	GetAddrTxs struct {
+		AddrFrom     string
+		PubKeyHashes [][]byte
+	}
+
+	//AddrTxs answers GetAddrTxs, Proofs[i] shows Transactions[i] is in its block
+	AddrTxs struct {
+		AddrFrom     string
+		Transactions [][]byte
+		Proofs       []blockchain.TxProof
+	}
+)
+
+const (
+	//lightRewind is how many headers below its tip a light node asks for
+	//again, so it follows reorganizations up to that depth
+	lightRewind = 10
+	lightSync   = 10 * time.Second
+)
+
+var (
+	lightAddresses []string
+)
+
+//StartLightNode syncs headers from the first known node and watches the
+//addresses with merkle proofs instead of downloading blocks. The headers have
+//to start from the genesis block with hash genesis
+func StartLightNode(nodeID string, genesis []byte, addresses []string) {
+	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+	lightAddresses = addresses
+	ln, err := net.Listen(protocol, nodeAddress)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer ln.Close()
+
+	headers, err := blockchain.OpenHeaderChain(nodeID, genesis)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer headers.Database.Close()
+	if headers.Genesis == nil {
+		log.Panic("the genesis block of the chain to sync is not known")
+	}
+	go func() {
+		d := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+		d.WaitForDeathWithFunc(func() {
+			defer os.Exit(1)
+			headers.Database.Close()
+		})
+	}()
+
+	fmt.Printf("Light node watching %d addresses\n", len(addresses))
+
+	go func() {
+		for {
+			RequestHeaders(headers)
+			time.Sleep(lightSync)
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Panic(err)
+		}
+		go HandleLightConnection(conn, headers)
+	}
+}
+
+//RequestHeaders asks for the headers above the tip of headers, starting a
+//few below it
+func RequestHeaders(headers *blockchain.HeaderChain) {
+	height, err := headers.Height()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if isRefused(KnownNodes[0]) {
+		fmt.Printf("Not syncing from %s: it is on another chain\n", KnownNodes[0])
+		return
+	}
+
+	from := height + 1 - lightRewind
+	if from < 0 {
+		from = 0
+	}
+	SendGetHeaders(KnownNodes[0], from)
+}
+
+func HandleLightConnection(conn net.Conn, headers *blockchain.HeaderChain) {
+	req, err := ioutil.ReadAll(conn)
+	defer conn.Close()
+
+	if err != nil {
+		log.Panic(err)
+	}
+	command := BytesToCmd(req[:commandLength])
+	fmt.Printf("Received %s command\n", command)
+
+	switch command {
+	case "headers":
+		HandleLightHeaders(req, headers)
+	case "addrtxs":
+		HandleAddrTxs(req, headers)
+	default:
+		fmt.Println("Ignored by light node")
+	}
+}
+
+func SendGetAddrTxs(address string, addresses []string) {
+	if NodeIsKnown(address) == false {
+		log.Panic("Address is not in the list of Known Nodes")
+	}
+
+	var pubKeyHashes [][]byte
+	for _, addr := range addresses {
+		pubKeyHash, err := wallet.AddressToPubKeyHash(addr)
+		if err != nil {
+			log.Panic(err)
+		}
+		pubKeyHashes = append(pubKeyHashes, pubKeyHash)
+	}
+
+	payload := GobEncode(GetAddrTxs{nodeAddress, pubKeyHashes})
+	request := append(CmdToBytes("getaddrtxs"), payload...)
+
+	SendData(address, request)
+}
+
+func HandleGetAddrTxs(request []byte, chain *blockchain.Blockchain) {
+	var buff bytes.Buffer
+	var payload GetAddrTxs
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	answer := AddrTxs{AddrFrom: nodeAddress}
+	for _, pubKeyHash := range payload.PubKeyHashes {
+		txs, proofs, err := chain.GetAddressProofs(pubKeyHash)
+		if err != nil {
+			log.Panic(err)
+		}
+		for i := range txs {
+			answer.Transactions = append(answer.Transactions, txs[i].Serialize())
+			answer.Proofs = append(answer.Proofs, proofs[i])
+		}
+	}
+
+	SendData(payload.AddrFrom, append(CmdToBytes("addrtxs"), GobEncode(answer)...))
+}
+
+func HandleLightHeaders(request []byte, headers *blockchain.HeaderChain) {
+	var buff bytes.Buffer
+	var payload Headers
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	for _, data := range payload.Headers {
+		header, err := blockchain.DeserializeHeader(data)
+		if err != nil {
+			fmt.Printf("Rejected header: %s\n", err)
+			return
+		}
+		if err := headers.AddHeader(header); errors.Is(err, blockchain.ErrBadGenesis) {
+			fmt.Printf("Refused peer %s: %s\n", payload.AddrFrom, err)
+			setRefused(payload.AddrFrom, true)
+			return
+		} else if err != nil {
+			fmt.Printf("Rejected header %x: %s\n", header.Hash(), err)
+			return
+		}
+	}
+
+	height, err := headers.Height()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Synced headers up to height %d\n", height)
+
+	if len(payload.Headers) == maxHeaders {
+		SendGetHeaders(payload.AddrFrom, height+1)
+		return
+	}
+	SendGetAddrTxs(payload.AddrFrom, lightAddresses)
+}
+
+func HandleAddrTxs(request []byte, headers *blockchain.HeaderChain) {
+	var buff bytes.Buffer
+	var payload AddrTxs
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	for i, data := range payload.Transactions {
+		tx, err := blockchain.DeserializeTransaction(data)
+		if err == nil && i < len(payload.Proofs) {
+			err = headers.AddProvenTx(tx, payload.Proofs[i])
+		}
+		if err != nil {
+			fmt.Printf("Rejected transaction %x: %s\n", tx.ID, err)
+		}
+	}
+
+	for _, address := range lightAddresses {
+		pubKeyHash, err := wallet.AddressToPubKeyHash(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		balance, err := headers.Balance(pubKeyHash)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Verified balance of %s: %d\n", address, balance)
+	}
+}
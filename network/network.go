@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,7 +12,9 @@ import (
 	"net"
 	"os"
 	"runtime"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/jasonlvhit/gocron"
 	"github.com/test-blockchain/blockchain"
@@ -22,6 +25,10 @@ const (
 	protocol      = "tcp"
 	version       = 1
 	commandLength = 12
+	//maxHeaders is how many headers are sent in one headers message
+	maxHeaders = 2000
+	//fetchWait is how long FetchTransaction waits for the answer
+	fetchWait = 10 * time.Second
 )
 
 var (
@@ -29,13 +36,16 @@ var (
 	NodeAddress        string
 	KnownNodes         = []string{0: "localhost:10111", 1: "localhost:10112", 2: "localhost:10113", 3: "localhost:10114"}
 	blocksInTransit    = [][]byte{}
-	memoryPool         = make(map[string]blockchain.Transaction)
-	tempTxPool         []string
 	tempStakeTxPool    = make(map[string]blockchain.Transaction)
 	candidateTxs       = make(chan blockchain.Transaction)
 	currentChain       *blockchain.Blockchain
 	validator          = make(map[string]int)
 	validatorBlacklist []string
+	//pool holds the transactions waiting to be forged
+	pool *blockchain.Mempool
+	//refusedPeers are the nodes whose genesis block is not ours
+	refusedPeers = make(map[string]bool)
+	peersMutex   = &sync.Mutex{}
 )
 
 type (
@@ -48,9 +58,33 @@ type (
 		Block    []byte
 	}
 
-	//GetBlocks to send Blocks from one nodes to another
+	//GetBlocks to send Blocks from one nodes to another. Only the main chain
+	//blocks from Height up are sent
 	GetBlocks struct {
 		AddrFrom string
+		Height   int
+	}
+
+	//GetHeaders asks for the main chain headers starting at Height
+	GetHeaders struct {
+		AddrFrom string
+		Height   int
+	}
+
+	Headers struct {
+		AddrFrom string
+		Headers  [][]byte
+	}
+
+	//GetProof asks for the merkle proof of a transaction
+	GetProof struct {
+		AddrFrom string
+		TxID     []byte
+	}
+
+	Proof struct {
+		AddrFrom string
+		Proof    blockchain.TxProof
 	}
 
 	GetData struct {
@@ -70,11 +104,15 @@ type (
 		Transaction []byte
 	}
 
-	//Version is to sync blockchain between nodes
+	//Version is to sync blockchain between nodes. Nodes only sync with
+	//peers that have the same GenesisHash. Base is the oldest block the peer
+	//can send, the ones below were pruned
 	Version struct {
-		Version    int
-		LastHeight int
-		AddrFrom   string
+		Version     int
+		LastHeight  int
+		AddrFrom    string
+		GenesisHash []byte
+		Base        int
 	}
 )
 
@@ -129,10 +167,15 @@ func StartServer(nodeID, ForgerAddress string, forgeTime uint64) {
 	}
 	defer ln.Close()
 
-	chain := blockchain.NormalBlockchainProcess(nodeID)
+	chain, err := blockchain.NormalBlockchainProcess(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
 	defer chain.Database.Close()
 	go CloseDB(chain)
 
+	pool = blockchain.NewMempool(chain, blockchain.MaxPoolTxs, blockchain.MaxPoolSize)
+
 	if nodeAddress != KnownNodes[0] {
 		SendVersion(KnownNodes[0], chain)
 	}
@@ -141,6 +184,9 @@ func StartServer(nodeID, ForgerAddress string, forgeTime uint64) {
 	fmt.Println("nodeAddress = ", nodeAddress)
 
 	if nodeAddress == KnownNodes[0] {
+		if forgeTime == 0 {
+			forgeTime = chain.Config.Params.ForgeInterval
+		}
 		fmt.Println("Start ForgeTimer")
 		go func() { StartForgeTimer(chain, forgeTime) }()
 	}
@@ -170,13 +216,33 @@ func StartForgeTimer(chain *blockchain.Blockchain, forgeTiming uint64) {
 	if nodeAddress == KnownNodes[0] {
 
 		currentChain = chain
+
+		mutex.Lock()
+		for _, v := range chain.Config.Validators {
+			validator[v.Address] = v.Stake
+		}
+		mutex.Unlock()
+
 		go func() {
 			for candidateTx := range candidateTxs {
+				// a stake is a signed payment to the validator itself, it
+				// shows the validator holds the staked coins. It is pooled
+				// like a payment so it gets forged, and the coins cannot be
+				// staked again until they are spent by another stake
+				address, stake, err := blockchain.StakeOf(&candidateTx)
+				if err != nil {
+					fmt.Printf("Rejected stake %x: %s\n", candidateTx.ID, err)
+					continue
+				}
+				err = pool.Add(&candidateTx)
+
 				mutex.Lock()
-				if chain.VerifyTransaction(&candidateTx) {
+				if err == nil {
 					tempStakeTxPool[hex.EncodeToString(candidateTx.ID)] = candidateTx
-				} else {
-					validatorBlacklist = append(validatorBlacklist, candidateTx.Inputs[0].SenderAddress)
+					validator[address] = stake
+				} else if !errors.Is(err, blockchain.ErrTxInPool) {
+					fmt.Printf("Rejected stake %x: %s\n", candidateTx.ID, err)
+					validatorBlacklist = append(validatorBlacklist, address)
 				}
 				mutex.Unlock()
 			}
@@ -184,7 +250,7 @@ func StartForgeTimer(chain *blockchain.Blockchain, forgeTiming uint64) {
 	}
 
 	fmt.Println("gocron run")
-	gocron.Every(5).Second().Do(PickWinner)
+	gocron.Every(forgeTiming).Seconds().Do(PickWinner)
 	<-gocron.Start()
 }
 
@@ -200,7 +266,7 @@ func HandleConnection(conn net.Conn, chain *blockchain.Blockchain) {
 
 	switch command {
 	case "addr":
-		HandleAddr(req)
+		HandleAddr(req, chain)
 	case "block":
 		HandleBlock(req, chain)
 	case "inv":
@@ -209,6 +275,18 @@ func HandleConnection(conn net.Conn, chain *blockchain.Blockchain) {
 		HandleGetBlocks(req, chain)
 	case "getdata":
 		HandleGetData(req, chain)
+	case "getheaders":
+		HandleGetHeaders(req, chain)
+	case "headers":
+		HandleHeaders(req, chain)
+	case "getproof":
+		HandleGetProof(req, chain)
+	case "getsnapshot":
+		HandleGetSnapshot(req, chain)
+	case "getaddrtxs":
+		HandleGetAddrTxs(req, chain)
+	case "proof":
+		HandleProof(req, chain)
 	case "tx":
 		HandleTx(req, chain)
 	case "Staketx":
@@ -221,6 +299,37 @@ func HandleConnection(conn net.Conn, chain *blockchain.Blockchain) {
 
 }
 
+//fetch listens on the address of nodeID, calls ask and returns the payload
+//of the first command message it receives before wait is over
+func fetch(nodeID, command string, wait time.Duration, ask func()) ([]byte, error) {
+	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+	ln, err := net.Listen(protocol, nodeAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	ask()
+
+	if err := ln.(*net.TCPListener).SetDeadline(time.Now().Add(wait)); err != nil {
+		return nil, err
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return nil, fmt.Errorf("no %s from %s: %w", command, KnownNodes[0], err)
+		}
+		req, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil || len(req) < commandLength || BytesToCmd(req[:commandLength]) != command {
+			continue
+		}
+
+		return req[commandLength:], nil
+	}
+}
+
 func ExtractCMD(request []byte) []byte {
 	return request[:commandLength]
 }
@@ -286,6 +395,32 @@ func SendTx(addr string, tnx *blockchain.Transaction) {
 	SendData(addr, request)
 }
 
+//FetchTransaction asks the first known node for its pending transaction with
+//ID id and waits for the answer on the address of nodeID
+func FetchTransaction(nodeID string, id []byte) (*blockchain.Transaction, error) {
+	data, err := fetch(nodeID, "tx", fetchWait, func() {
+		SendGetData(KnownNodes[0], "tx", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var payload Tx
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	tx, err := blockchain.DeserializeTransaction(payload.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tx.ID, id) || !bytes.Equal(tx.ID, tx.Hash()) {
+		return nil, fmt.Errorf("%s sent another transaction than %x", KnownNodes[0], id)
+	}
+
+	return &tx, nil
+}
+
 func SendStakeTx(addr string, tnx *blockchain.Transaction) {
 	var (
 		request []byte
@@ -306,8 +441,15 @@ func SendVersion(addr string, chain *blockchain.Blockchain) {
 	if NodeIsKnown(addr) == false {
 		log.Panic("Address is not in the list of Known Nodes")
 	}
-	bestHeight := chain.GetLastHeight()
-	payload := GobEncode(Version{version, bestHeight, nodeAddress})
+	bestHeight, err := chain.GetLastHeight()
+	if err != nil {
+		log.Panic(err)
+	}
+	genesisHash, err := chain.GenesisHash()
+	if err != nil {
+		log.Panic(err)
+	}
+	payload := GobEncode(Version{version, bestHeight, nodeAddress, genesisHash, chain.Base})
 
 	request := append(CmdToBytes("version"), payload...)
 
@@ -325,17 +467,17 @@ func SendInv(address, kind string, items [][]byte) {
 	SendData(address, request)
 }
 
-func SendGetBlocks(address string) {
+func SendGetBlocks(address string, chain *blockchain.Blockchain) {
 	if NodeIsKnown(address) == false {
 		log.Panic("Address is not in the list of Known Nodes")
 	}
-	payload := GobEncode(GetBlocks{nodeAddress})
+	payload := GobEncode(GetBlocks{nodeAddress, chain.Base})
 	request := append(CmdToBytes("getblocks"), payload...)
 
 	SendData(address, request)
 }
 
-func HandleAddr(request []byte) {
+func HandleAddr(request []byte, chain *blockchain.Blockchain) {
 	var buff bytes.Buffer
 	var payload Addr
 
@@ -347,7 +489,7 @@ func HandleAddr(request []byte) {
 
 	}
 
-	RequestBlocks()
+	RequestBlocks(chain)
 }
 
 func HandleBlock(request []byte, chain *blockchain.Blockchain) {
@@ -360,14 +502,26 @@ func HandleBlock(request []byte, chain *blockchain.Blockchain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
 
 	blockData := payload.Block
-	block := blockchain.Deserialize(blockData)
+	block, err := blockchain.Deserialize(blockData)
+	if err != nil {
+		fmt.Printf("Rejected block: %s\n", err)
+		return
+	}
 
 	fmt.Println("Received a new block!")
-	chain.AddBlock(block)
+	update, err := chain.ProcessBlock(block)
+	if err != nil {
+		fmt.Printf("Rejected block %x: %s\n", block.Hash, err)
+		return
+	}
 
 	fmt.Printf("Added block %x\n", block.Hash)
+	pool.UpdateTip(update)
 
 	if len(blocksInTransit) > 0 {
 		blockHash := blocksInTransit[0]
@@ -387,13 +541,21 @@ func HandleInv(request []byte, chain *blockchain.Blockchain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
 
 	fmt.Printf("Received inventory with %d %s\n", len(payload.Items), payload.Type)
 
 	if payload.Type == "block" {
-		blocksInTransit = payload.Items
+		//hashes come from the tip down, request them from the oldest so every
+		//block arrives after its parent and passes validation
+		blocksInTransit = [][]byte{}
+		for i := len(payload.Items) - 1; i >= 0; i-- {
+			blocksInTransit = append(blocksInTransit, payload.Items[i])
+		}
 
-		blockHash := payload.Items[0]
+		blockHash := blocksInTransit[0]
 		SendGetData(payload.AddrFrom, "block", blockHash)
 
 		newInTransit := [][]byte{}
@@ -408,7 +570,7 @@ func HandleInv(request []byte, chain *blockchain.Blockchain) {
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
-		if memoryPool[hex.EncodeToString(txID)].ID == nil {
+		if _, ok := pool.Get(txID); !ok {
 			SendGetData(payload.AddrFrom, "tx", txID)
 		}
 	}
@@ -428,11 +590,149 @@ func HandleGetBlocks(request []byte, chain *blockchain.Blockchain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
 
-	blocks := chain.GetBlockHashes()
+	blocks, err := chain.GetBlockHashes(payload.Height)
+	if err != nil {
+		log.Panic(err)
+	}
 	SendInv(payload.AddrFrom, "block", blocks)
 }
 
+func SendGetHeaders(address string, height int) {
+	if NodeIsKnown(address) == false {
+		log.Panic("Address is not in the list of Known Nodes")
+	}
+	payload := GobEncode(GetHeaders{nodeAddress, height})
+	request := append(CmdToBytes("getheaders"), payload...)
+
+	SendData(address, request)
+}
+
+func SendHeaders(address string, headers []blockchain.BlockHeader) {
+	if NodeIsKnown(address) == false {
+		log.Panic("Address is not in the list of Known Nodes")
+	}
+
+	var items [][]byte
+	for _, header := range headers {
+		items = append(items, header.Serialize())
+	}
+
+	payload := GobEncode(Headers{nodeAddress, items})
+	request := append(CmdToBytes("headers"), payload...)
+
+	SendData(address, request)
+}
+
+func HandleGetHeaders(request []byte, chain *blockchain.Blockchain) {
+	var buff bytes.Buffer
+	var payload GetHeaders
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	headers, err := chain.GetHeaders(payload.Height, maxHeaders)
+	if err != nil {
+		log.Panic(err)
+	}
+	SendHeaders(payload.AddrFrom, headers)
+}
+
+func HandleHeaders(request []byte, chain *blockchain.Blockchain) {
+	var buff bytes.Buffer
+	var payload Headers
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	added := 0
+	for _, data := range payload.Headers {
+		header, err := blockchain.DeserializeHeader(data)
+		if err != nil {
+			fmt.Printf("Rejected header: %s\n", err)
+			return
+		}
+		if err := chain.AddHeader(header); err != nil {
+			fmt.Printf("Rejected header %x: %s\n", header.Hash(), err)
+			return
+		}
+		added++
+	}
+
+	fmt.Printf("Received %d headers\n", added)
+}
+
+func SendGetProof(address string, txID []byte) {
+	if NodeIsKnown(address) == false {
+		log.Panic("Address is not in the list of Known Nodes")
+	}
+	payload := GobEncode(GetProof{nodeAddress, txID})
+	request := append(CmdToBytes("getproof"), payload...)
+
+	SendData(address, request)
+}
+
+func HandleGetProof(request []byte, chain *blockchain.Blockchain) {
+	var buff bytes.Buffer
+	var payload GetProof
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	proof, err := chain.GetTxProof(payload.TxID)
+	if err != nil {
+		fmt.Printf("No proof for %x: %s\n", payload.TxID, err)
+		return
+	}
+
+	data := GobEncode(Proof{nodeAddress, proof})
+	SendData(payload.AddrFrom, append(CmdToBytes("proof"), data...))
+}
+
+func HandleProof(request []byte, chain *blockchain.Blockchain) {
+	var buff bytes.Buffer
+	var payload Proof
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	proof := payload.Proof
+	if !proof.Verify() {
+		fmt.Printf("Invalid proof for %x\n", proof.TxID)
+		return
+	}
+
+	fmt.Printf("Transaction %x is in block %x at height %d\n", proof.TxID, proof.BlockHash, proof.Header.Height)
+}
+
 func HandleGetData(request []byte, chain *blockchain.Blockchain) {
 	var buff bytes.Buffer
 	var payload GetData
@@ -443,10 +743,14 @@ func HandleGetData(request []byte, chain *blockchain.Blockchain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
 
 	if payload.Type == "block" {
 		block, err := chain.GetBlock([]byte(payload.ID))
 		if err != nil {
+			fmt.Printf("Cannot send block %x: %s\n", payload.ID, err)
 			return
 		}
 
@@ -454,15 +758,23 @@ func HandleGetData(request []byte, chain *blockchain.Blockchain) {
 	}
 
 	if payload.Type == "tx" {
-		txID := hex.EncodeToString(payload.ID)
-		tx := memoryPool[txID]
+		tx, ok := pool.Get(payload.ID)
+		if !ok {
+			fmt.Printf("Cannot send transaction %x: not pending\n", payload.ID)
+			return
+		}
 
 		SendTx(payload.AddrFrom, &tx)
 	}
 
 	if payload.Type == "Staketx" {
-		txID := hex.EncodeToString(payload.ID)
-		tx := memoryPool[txID]
+		mutex.Lock()
+		tx, ok := tempStakeTxPool[hex.EncodeToString(payload.ID)]
+		mutex.Unlock()
+		if !ok {
+			fmt.Printf("Cannot send stake transaction %x: not pending\n", payload.ID)
+			return
+		}
 
 		SendStakeTx(payload.AddrFrom, &tx)
 	}
@@ -478,19 +790,28 @@ func HandleTx(request []byte, chain *blockchain.Blockchain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
 
 	txData := payload.Transaction
-	tx := blockchain.DeserializeTransaction(txData)
-	memoryPool[hex.EncodeToString(tx.ID)] = tx
-	//add the ID to the temp TxPool to be forged later
-	tempTxPool = append(tempTxPool, hex.EncodeToString(tx.ID))
+	tx, err := blockchain.DeserializeTransaction(txData)
+	if err != nil {
+		fmt.Printf("Rejected transaction: %s\n", err)
+		return
+	}
+	//the pool keeps it until it is forged
+	if err := pool.Add(&tx); err != nil {
+		fmt.Printf("Rejected transaction %x: %s\n", tx.ID, err)
+		return
+	}
 
-	fmt.Printf("%s, %d", nodeAddress, len(memoryPool))
+	fmt.Printf("%s, %d pending\n", nodeAddress, pool.Count())
 
 	if nodeAddress == KnownNodes[0] {
 		for _, node := range KnownNodes {
 			if node != nodeAddress && node != payload.AddrFrom {
-				SendInv(node, "Staketx", [][]byte{tx.ID})
+				SendInv(node, "tx", [][]byte{tx.ID})
 			}
 		}
 	}
@@ -506,17 +827,20 @@ func HandleStakeTx(request []byte, chain *blockchain.Blockchain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
 
 	txData := payload.Transaction
-	tx := blockchain.DeserializeTransaction(txData)
-	memoryPool[hex.EncodeToString(tx.ID)] = tx
-
+	tx, err := blockchain.DeserializeTransaction(txData)
+	if err != nil {
+		fmt.Printf("Rejected transaction: %s\n", err)
+		return
+	}
 	if isBlacklist(validatorBlacklist, tx) == false {
 		candidateTxs <- tx
 	}
 
-	fmt.Printf("%s, %d", nodeAddress, len(memoryPool))
-
 	if nodeAddress == KnownNodes[0] {
 		for _, node := range KnownNodes {
 			if node != nodeAddress && node != payload.AddrFrom {
@@ -537,19 +861,35 @@ func HandleVersion(request []byte, chain *blockchain.Blockchain) {
 		log.Panic(err)
 	}
 
-	LastHeight := chain.GetLastHeight()
+	genesisHash, err := chain.GenesisHash()
+	if err != nil {
+		log.Panic(err)
+	}
+	if !bytes.Equal(payload.GenesisHash, genesisHash) {
+		fmt.Printf("Refused peer %s: genesis %x is not %x\n", payload.AddrFrom, payload.GenesisHash, genesisHash)
+		setRefused(payload.AddrFrom, true)
+		return
+	}
+	setRefused(payload.AddrFrom, false)
+
+	LastHeight, err := chain.GetLastHeight()
+	if err != nil {
+		log.Panic(err)
+	}
 	otherHeight := payload.LastHeight
 
-	if LastHeight < otherHeight {
-		SendGetBlocks(payload.AddrFrom)
+	if LastHeight < otherHeight && LastHeight+1 < payload.Base {
+		fmt.Printf("Cannot sync from %s: it pruned the blocks below %d\n", payload.AddrFrom, payload.Base)
+	} else if LastHeight < otherHeight {
+		SendGetBlocks(payload.AddrFrom, chain)
 	} else if LastHeight > otherHeight {
 		SendVersion(payload.AddrFrom, chain)
 	}
 }
 
-func RequestBlocks() {
+func RequestBlocks(chain *blockchain.Blockchain) {
 	for _, node := range KnownNodes {
-		SendGetBlocks(node)
+		SendGetBlocks(node, chain)
 	}
 }
 
@@ -560,9 +900,35 @@ func SendGetData(address, kind string, id []byte) {
 	SendData(address, request)
 }
 
+//setRefused records whether the last version of addr had another genesis
+func setRefused(addr string, refused bool) {
+	peersMutex.Lock()
+	defer peersMutex.Unlock()
+	if refused {
+		refusedPeers[addr] = true
+	} else {
+		delete(refusedPeers, addr)
+	}
+}
+
+//isRefused reports whether addr was found on another chain, what it sends
+//is ignored
+func isRefused(addr string) bool {
+	peersMutex.Lock()
+	defer peersMutex.Unlock()
+	return refusedPeers[addr]
+}
+
+//isBlacklist reports whether the signer of the stake tx sent an invalid stake
+//before. Transactions that are not stakes count as blacklisted
 func isBlacklist(validatorBlacklist []string, tx blockchain.Transaction) bool {
+	address, _, err := blockchain.StakeOf(&tx)
+	if err != nil {
+		return true
+	}
+
 	for _, blacklistValidator := range validatorBlacklist {
-		if tx.Inputs[0].SenderAddress == blacklistValidator {
+		if address == blacklistValidator {
 			return true
 		}
 	}
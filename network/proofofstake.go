@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dgraph-io/badger"
 	"github.com/test-blockchain/blockchain"
 )
 
@@ -20,12 +19,12 @@ type (
 	ProofOfStake struct {
 		lastHeight int
 		lastHash   []byte
+		chainID    string
 	}
 )
 
 var (
-	mutex      = &sync.Mutex{}
-	pendingTxs []*blockchain.Transaction
+	mutex = &sync.Mutex{}
 )
 
 func TestScheduler() {
@@ -34,16 +33,16 @@ func TestScheduler() {
 
 func PickWinner() {
 	fmt.Println("start picking lottery")
-	mutex.Lock()
-	//lock the variables
-	for _, tempId := range tempTxPool {
-		tx := memoryPool[tempId]
-		if currentChain.VerifyTransaction(&tx) {
-			pendingTxs = append(pendingTxs, &tx)
-		}
+	pos := NewProofOfStake()
+	pos.GetLastHash(currentChain)
+	lastHash := pos.lastHash
+	lastHeight := pos.lastHeight
 
-	}
+	//transactions whose lock time has not come stay pending
+	pendingTxs, fees := pool.Transactions(lastHeight+1, time.Now().Unix())
 
+	mutex.Lock()
+	//lock the variables
 	fmt.Println("tempStakeTxPool = ", tempStakeTxPool)
 	temp := tempStakeTxPool
 	mutex.Unlock()
@@ -57,9 +56,13 @@ func PickWinner() {
 	OUTER:
 		//check each Stake transactions if already in the lottery pool
 		for _, tx := range temp {
+			address, _, err := blockchain.StakeOf(&tx)
+			if err != nil {
+				continue
+			}
 			// if already in lottery pool, skip
 			for _, LotteryTx := range lotterypool {
-				if tx.Outputs[0].Address == LotteryTx {
+				if address == LotteryTx {
 					continue OUTER
 				}
 			}
@@ -69,14 +72,32 @@ func PickWinner() {
 			setValidators := validator
 			mutex.Unlock()
 
-			k, ok := setValidators[tx.Inputs[0].SenderAddress]
+			k, ok := setValidators[address]
 			if ok {
 				for i := 0; i < k; i++ {
-					lotterypool = append(lotterypool, tx.Inputs[0].SenderAddress)
+					lotterypool = append(lotterypool, address)
+				}
+			}
+		}
+	}
+
+	// the validators of the genesis file forge pending transactions even when
+	// none of them sent a stake transaction
+	if len(pendingTxs) > 0 {
+	GENESIS:
+		for _, v := range currentChain.Config.Validators {
+			for _, LotteryTx := range lotterypool {
+				if v.Address == LotteryTx {
+					continue GENESIS
 				}
 			}
+			for i := 0; i < v.Stake; i++ {
+				lotterypool = append(lotterypool, v.Address)
+			}
 		}
+	}
 
+	if len(lotterypool) > 0 {
 		// randomly pick winner from lottery pool
 		s := rand.NewSource(time.Now().Unix())
 		r := rand.New(s)
@@ -84,20 +105,25 @@ func PickWinner() {
 
 		fmt.Println("Winner selected = ", lotteryWinner)
 
-		TxLotteryWinner := temp[lotteryWinner]
+		// the winner is paid the block subsidy and the fees by the coinbase of
+		// the block it forges
+		reward := currentChain.Config.BlockSubsidy(lastHeight+1) + fees
+		coinbase, err := blockchain.CoinbaseTx(lotteryWinner, "", reward)
+		if err != nil {
+			fmt.Printf("Cannot pay winner %s: %s\n", lotteryWinner, err)
+			return
+		}
+		pendingTxs = append([]*blockchain.Transaction{coinbase}, pendingTxs...)
 
 		// add block of winner to blockchain and let all the other nodes know
-
-		//	LINK TO THE FUNCTION TO ADD BLOCK TO BLOCKCHAIN AND BROADCAST
-		pendingTxs = append(pendingTxs, &TxLotteryWinner)
-		pos := NewProofOfStake()
-		pos.GetLastHash(currentChain)
-		lastHash := pos.lastHash
-		lastHeight := pos.lastHeight
-		block := &blockchain.Block{[]byte{}, pendingTxs, lastHash, lastHeight, lotteryWinner, time.Now().Unix()}
+		block := blockchain.CreateBlock(pendingTxs, lastHash, lotteryWinner, lastHeight+1, pos.chainID)
 		hash := block.BlockHashing()
 		block.Hash = hash[:]
-		currentChain.AddBlock(block)
+		if update, err := currentChain.ProcessBlock(block); err != nil {
+			fmt.Printf("Forged block %x is not valid: %s\n", block.Hash, err)
+		} else {
+			pool.UpdateTip(update)
+		}
 	}
 
 	mutex.Lock()
@@ -108,32 +134,19 @@ func PickWinner() {
 }
 
 func (pos *ProofOfStake) GetLastHash(chain *blockchain.Blockchain) {
-	err := chain.Database.View(func(txn *badger.Txn) error {
-
-		item, err := txn.Get([]byte("lh"))
-		if err != nil {
-			log.Panic(err)
-		}
-
-		lastHash, err := item.Value()
-
-		item, err = txn.Get(lastHash)
-		if err != nil {
-			log.Panic(err)
-		}
-		lastBlockData, _ := item.Value()
-
-		lastBlock := blockchain.Deserialize(lastBlockData)
-		lastHeight := lastBlock.Height
-
-		pos.lastHash = lastHash
-		pos.lastHeight = lastHeight
+	lastHash, err := chain.Database.GetTip()
+	if err != nil {
+		log.Panic(err)
+	}
 
-		return err
-	})
+	lastBlock, err := chain.Database.GetBlock(lastHash)
 	if err != nil {
 		log.Panic(err)
 	}
+
+	pos.lastHash = lastHash
+	pos.lastHeight = lastBlock.Height
+	pos.chainID = lastBlock.ChainID
 }
 
 func NewProofOfStake() *ProofOfStake {
@@ -0,0 +1,87 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/test-blockchain/blockchain"
+)
+
+type (
+	//GetSnapshot asks for the UTXO snapshot at Height, or at the tip when
+	//Height is negative
+	GetSnapshot struct {
+		AddrFrom string
+		Height   int
+	}
+
+	Snapshot struct {
+		AddrFrom string
+		Snapshot []byte
+	}
+)
+
+const (
+	//snapshotWait is how long FetchSnapshot waits for the answer
+	snapshotWait = 60 * time.Second
+)
+
+func SendGetSnapshot(address string, height int) {
+	if NodeIsKnown(address) == false {
+		log.Panic("Address is not in the list of Known Nodes")
+	}
+	payload := GobEncode(GetSnapshot{nodeAddress, height})
+	request := append(CmdToBytes("getsnapshot"), payload...)
+
+	SendData(address, request)
+}
+
+func HandleGetSnapshot(request []byte, chain *blockchain.Blockchain) {
+	var buff bytes.Buffer
+	var payload GetSnapshot
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+	if isRefused(payload.AddrFrom) {
+		return
+	}
+
+	snapshot, err := chain.Snapshot(payload.Height)
+	if err != nil {
+		fmt.Printf("No snapshot at height %d: %s\n", payload.Height, err)
+		return
+	}
+
+	data := GobEncode(Snapshot{nodeAddress, snapshot.Serialize()})
+	SendData(payload.AddrFrom, append(CmdToBytes("snapshot"), data...))
+}
+
+//FetchSnapshot asks the first known node for the snapshot at height and waits
+//for the answer on the address of nodeID. The snapshot is checked with Verify
+func FetchSnapshot(nodeID string, height int) (*blockchain.Snapshot, error) {
+	data, err := fetch(nodeID, "snapshot", snapshotWait, func() {
+		SendGetSnapshot(KnownNodes[0], height)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var payload Snapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := blockchain.DeserializeSnapshot(payload.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, snapshot.Verify()
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+const (
+	//scriptVersion is the version byte of multisig and script addresses
+	scriptVersion = byte(0x05)
+	//MaxMultisigKeys is the most keys a redeem script holds
+	MaxMultisigKeys = 16
+)
+
+var (
+	ErrInvalidRedeemScript = errors.New("redeem script is not valid")
+)
+
+//RedeemScript is what an M of N multisig address is the hash of: M, N and the
+//public keys sorted, so the same keys always give the same address
+func RedeemScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if m < 1 || m > n || n > MaxMultisigKeys {
+		return nil, ErrInvalidRedeemScript
+	}
+
+	keys := append([][]byte{}, pubKeys...)
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	script := []byte{byte(m), byte(n)}
+	for i, key := range keys {
+		if len(key) != PublicKeyLength {
+			return nil, ErrInvalidPublicKey
+		}
+		if _, err := ParsePublicKey(key); err != nil {
+			return nil, err
+		}
+		if i > 0 && bytes.Equal(key, keys[i-1]) {
+			return nil, ErrInvalidRedeemScript
+		}
+		script = append(script, key...)
+	}
+
+	return script, nil
+}
+
+//ParseRedeemScript returns M and the public keys of a script written by
+//RedeemScript
+func ParseRedeemScript(script []byte) (int, [][]byte, error) {
+	if len(script) < 2 {
+		return 0, nil, ErrInvalidRedeemScript
+	}
+
+	m, n := int(script[0]), int(script[1])
+	if m < 1 || m > n || n > MaxMultisigKeys || len(script) != 2+n*PublicKeyLength {
+		return 0, nil, ErrInvalidRedeemScript
+	}
+
+	var keys [][]byte
+	for i := 0; i < n; i++ {
+		key := script[2+i*PublicKeyLength : 2+(i+1)*PublicKeyLength]
+		if _, err := ParsePublicKey(key); err != nil {
+			return 0, nil, err
+		}
+		if i > 0 && bytes.Compare(keys[i-1], key) >= 0 {
+			return 0, nil, ErrInvalidRedeemScript
+		}
+		keys = append(keys, key)
+	}
+
+	return m, keys, nil
+}
+
+//MultisigAddress is the address of the outputs the keys of script unlock
+func MultisigAddress(script []byte) []byte {
+	return ScriptAddress(script)
+}
+
+//ScriptAddress is the address of the outputs locked by script, multisig
+//redeem scripts included
+func ScriptAddress(script []byte) []byte {
+	return encodeAddress(scriptVersion, PublicKeyHash(script))
+}
+
+//IsMultisigAddress tells a valid multisig address apart from the address of a
+//single key
+func IsMultisigAddress(address string) bool {
+	if !ValidateAddress(address) {
+		return false
+	}
+
+	fullHash, err := Base58Decode([]byte(address))
+	return err == nil && fullHash[0] == scriptVersion
+}
@@ -0,0 +1,64 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedeemScript(t *testing.T) {
+	var keys [][]byte
+	for i := 0; i < 3; i++ {
+		_, key, err := NewPairKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	script, err := RedeemScript(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed, err := RedeemScript(2, [][]byte{keys[2], keys[1], keys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(MultisigAddress(script), MultisigAddress(reversed)) {
+		t.Fatal("the order of the keys changed the address")
+	}
+
+	m, parsed, err := ParseRedeemScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != 2 || len(parsed) != 3 {
+		t.Fatalf("parsed %d of %d keys, want 2 of 3", m, len(parsed))
+	}
+	for i := 1; i < len(parsed); i++ {
+		if bytes.Compare(parsed[i-1], parsed[i]) >= 0 {
+			t.Fatal("keys are not sorted")
+		}
+	}
+
+	address := string(MultisigAddress(script))
+	if !ValidateAddress(address) || !IsMultisigAddress(address) {
+		t.Fatalf("%s is not a valid multisig address", address)
+	}
+	if IsMultisigAddress(string(PubKeyAddress(keys[0]))) {
+		t.Fatal("address of a single key taken for a multisig address")
+	}
+
+	for name, bad := range map[string]func() ([]byte, error){
+		"m of 0":         func() ([]byte, error) { return RedeemScript(0, keys) },
+		"m above n":      func() ([]byte, error) { return RedeemScript(4, keys) },
+		"duplicate keys": func() ([]byte, error) { return RedeemScript(1, [][]byte{keys[0], keys[0]}) },
+		"invalid key":    func() ([]byte, error) { return RedeemScript(1, [][]byte{keys[0][1:]}) },
+	} {
+		if _, err := bad(); err == nil {
+			t.Errorf("%s: redeem script made", name)
+		}
+	}
+	if _, _, err := ParseRedeemScript(script[:len(script)-1]); err != ErrInvalidRedeemScript {
+		t.Fatalf("truncated script: got %v, want %v", err, ErrInvalidRedeemScript)
+	}
+}
@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+const (
+	//coordLength is the length of a P256 coordinate or scalar
+	coordLength = 32
+	//PublicKeyLength is the length of a public key: X||Y
+	PublicKeyLength = 2 * coordLength
+	//SignatureLength is the length of a signature: r||s
+	SignatureLength = 2 * coordLength
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("public key is not valid")
+)
+
+//MarshalPublicKey encodes a P256 public key as X||Y, each coordinate padded to
+//32 bytes
+func MarshalPublicKey(pub *ecdsa.PublicKey) []byte {
+	data := make([]byte, PublicKeyLength)
+	pub.X.FillBytes(data[:coordLength])
+	pub.Y.FillBytes(data[coordLength:])
+	return data
+}
+
+//ParsePublicKey reads a public key written by MarshalPublicKey. It also reads
+//the unpadded X||Y of wallets made before it, shorter when a coordinate is,
+//so the outputs locked to those keys stay spendable
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	start := len(data) - coordLength
+	if start < 1 {
+		start = 1
+	}
+	for split := start; split <= coordLength && split < len(data); split++ {
+		x := new(big.Int).SetBytes(data[:split])
+		y := new(big.Int).SetBytes(data[split:])
+		if curve.IsOnCurve(x, y) {
+			return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+		}
+	}
+
+	return nil, ErrInvalidPublicKey
+}
+
+//legacyPublicKey is the unpadded X||Y older wallets used as public key
+func legacyPublicKey(pub *ecdsa.PublicKey) []byte {
+	return append(pub.X.Bytes(), pub.Y.Bytes()...)
+}
+
+//Sign signs a 32 byte hash and returns r||s, each padded to 32 bytes
+func Sign(privKey *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, SignatureLength)
+	r.FillBytes(signature[:coordLength])
+	s.FillBytes(signature[coordLength:])
+
+	return signature, nil
+}
+
+//Verify checks a signature made by Sign against a public key written by
+//MarshalPublicKey
+func Verify(pubKey, hash, signature []byte) bool {
+	pub, err := ParsePublicKey(pubKey)
+	if err != nil || len(signature) != SignatureLength {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:coordLength])
+	s := new(big.Int).SetBytes(signature[coordLength:])
+
+	return ecdsa.Verify(pub, hash, r, s)
+}
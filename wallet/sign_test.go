@@ -0,0 +1,51 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	privKey, pubKey, err := NewPairKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePublicKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(MarshalPublicKey(parsed), pubKey) {
+		t.Fatal("public key does not round-trip")
+	}
+
+	hash := sha256.Sum256([]byte("transaction"))
+	signature, err := Sign(&privKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != SignatureLength {
+		t.Fatalf("signature of %d bytes, want %d", len(signature), SignatureLength)
+	}
+	if !Verify(pubKey, hash[:], signature) {
+		t.Fatal("signature rejected")
+	}
+
+	other := sha256.Sum256([]byte("another transaction"))
+	if Verify(pubKey, other[:], signature) {
+		t.Fatal("signature verified for another hash")
+	}
+	_, otherKey, err := NewPairKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Verify(otherKey, hash[:], signature) {
+		t.Fatal("signature verified with another key")
+	}
+	if Verify(pubKey, hash[:], signature[1:]) {
+		t.Fatal("truncated signature verified")
+	}
+	if _, err := ParsePublicKey(make([]byte, PublicKeyLength)); err != ErrInvalidPublicKey {
+		t.Fatalf("point off the curve: got %v, want %v", err, ErrInvalidPublicKey)
+	}
+}
@@ -1,8 +1,6 @@
 package wallet
 
 import (
-	"log"
-
 	"github.com/mr-tron/base58"
 )
 
@@ -12,11 +10,6 @@ func Base58Encode(input []byte) []byte {
 	return []byte(encoded)
 }
 
-func Base58Decode(input []byte) []byte {
-	decoded, err := base58.Decode(string(input[:]))
-	if err != nil {
-		log.Panic(err)
-	}
-
-	return decoded
+func Base58Decode(input []byte) ([]byte, error) {
+	return base58.Decode(string(input[:]))
 }
@@ -6,8 +6,9 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"fmt"
+	"errors"
 	"log"
+	"math/big"
 
 	"golang.org/x/crypto/ripemd160"
 )
@@ -24,23 +25,30 @@ const (
 	checksumLength = 4
 )
 
-func NewPairKey() (ecdsa.PrivateKey, []byte) {
+var (
+	ErrInvalidAddress = errors.New("address is not valid")
+	ErrWalletNotFound = errors.New("wallet is not found")
+)
+
+func NewPairKey() (ecdsa.PrivateKey, []byte, error) {
 	curve := elliptic.P256()
 
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
-		log.Panic(err)
+		return ecdsa.PrivateKey{}, nil, err
 	}
 
-	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return *private, pub
+	return *private, MarshalPublicKey(&private.PublicKey), nil
 }
 
-func MakeWallet() *Wallet {
-	privateKey, publicKey := NewPairKey()
+func MakeWallet() (*Wallet, error) {
+	privateKey, publicKey, err := NewPairKey()
+	if err != nil {
+		return nil, err
+	}
 	wallet := Wallet{privateKey, publicKey}
 
-	return &wallet
+	return &wallet, nil
 }
 
 func PublicKeyHash(pubKey []byte) []byte {
@@ -65,7 +73,10 @@ func Checksum(payload []byte) []byte {
 }
 
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
+	pubKeyHash, err := Base58Decode([]byte(address))
+	if err != nil || len(pubKeyHash) <= checksumLength+1 {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-checksumLength:]
 	version := pubKeyHash[0]
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-checksumLength]
@@ -74,8 +85,21 @@ func ValidateAddress(address string) bool {
 	return bytes.Compare(actualChecksum, targetChecksum) == 0
 }
 
-func (wallet *Wallet) Address() []byte {
-	pubHash := PublicKeyHash(wallet.Publickey)
+//AddressToPubKeyHash returns the public key hash an address is made of
+func AddressToPubKeyHash(address string) ([]byte, error) {
+	if !ValidateAddress(address) {
+		return nil, ErrInvalidAddress
+	}
+
+	fullHash, err := Base58Decode([]byte(address))
+	if err != nil {
+		return nil, err
+	}
+
+	return fullHash[1 : len(fullHash)-checksumLength], nil
+}
+
+func encodeAddress(version byte, pubHash []byte) []byte {
 	versionedHash := append([]byte{version}, pubHash...)
 	checksum := Checksum(versionedHash)
 
@@ -83,8 +107,54 @@ func (wallet *Wallet) Address() []byte {
 	address := Base58Encode(fullHash)
 
 	return address
-	fmt.Println("Public Key Hash - ", pubHash)
-	fmt.Printf("address: %x\n", address)
+}
 
-	return address
+func (wallet *Wallet) Address() []byte {
+	return PubKeyAddress(wallet.Publickey)
+}
+
+//PubKeyAddress is the address of the outputs pubKey unlocks
+func PubKeyAddress(pubKey []byte) []byte {
+	return encodeAddress(version, PublicKeyHash(pubKey))
+}
+
+//GobEncode keeps only the private scalar and the public key, the curve can
+//not be gob encoded and is always P256
+func (wallet Wallet) GobEncode() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	d := wallet.PrivateKey.D.Bytes()
+	buffer.WriteByte(byte(len(d)))
+	buffer.Write(d)
+	buffer.Write(wallet.Publickey)
+
+	return buffer.Bytes(), nil
+}
+
+func (wallet *Wallet) GobDecode(data []byte) error {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return errors.New("wallet data is too short")
+	}
+
+	*wallet = restoreWallet(new(big.Int).SetBytes(data[1:1+int(data[0])]), data[1+int(data[0]):])
+
+	return nil
+}
+
+//restoreWallet rebuilds the wallet of the private scalar d. The public key is
+//derived again, stored is only kept when it is the unpadded key of older
+//wallets, whose address is the hash of that form
+func restoreWallet(d *big.Int, stored []byte) Wallet {
+	curve := elliptic.P256()
+	private := ecdsa.PrivateKey{}
+	private.PublicKey.Curve = curve
+	private.D = d
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+
+	wallet := Wallet{private, MarshalPublicKey(&private.PublicKey)}
+	if legacy := legacyPublicKey(&private.PublicKey); bytes.Equal(stored, legacy) {
+		wallet.Publickey = legacy
+	}
+
+	return wallet
 }
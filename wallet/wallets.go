@@ -2,11 +2,10 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"math/big"
 	"os"
 )
 
@@ -15,22 +14,43 @@ const (
 )
 
 type (
+	//legacyWallets is the wallet file from before Wallet had GobEncode, when
+	//keys were gob encoded with their curve. The curve is always P256 and is
+	//left out
+	legacyWallets struct {
+		Wallets map[string]*struct {
+			PrivateKey struct {
+				D *big.Int
+			}
+			Publickey []byte
+		}
+	}
+
 	Wallets struct {
 		Wallets map[string]*Wallet
+		//Multisigs are the redeem scripts of the multisig addresses the
+		//wallets take part in, by address
+		Multisigs map[string][]byte
 	}
 )
 
 func CreateWallet(NodeId string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Multisigs = make(map[string][]byte)
 
 	err := wallets.LoadFile(NodeId)
 
 	return &wallets, err
 }
 
-func (ws Wallets) GetWalletFromAddress(address string) Wallet {
-	return *ws.Wallets[address]
+func (ws Wallets) GetWalletFromAddress(address string) (Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return Wallet{}, ErrWalletNotFound
+	}
+
+	return *wallet, nil
 }
 
 func (ws *Wallets) GetAllAddressFromWallet() []string {
@@ -43,35 +63,71 @@ func (ws *Wallets) GetAllAddressFromWallet() []string {
 	return addresses
 }
 
-func (ws *Wallets) AddNewWallet() string {
-	wallet := MakeWallet()
+func (ws *Wallets) AddNewWallet() (string, error) {
+	wallet, err := MakeWallet()
+	if err != nil {
+		return "", err
+	}
 	address := fmt.Sprintf("%s", wallet.Address())
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
+}
+
+//AddMultisig keeps the M of N multisig address of pubKeys and returns it
+func (ws *Wallets) AddMultisig(m int, pubKeys [][]byte) (string, error) {
+	script, err := RedeemScript(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	address := string(MultisigAddress(script))
+
+	ws.Multisigs[address] = script
+
+	return address, nil
+}
+
+//GetRedeemScript returns the redeem script of a multisig address kept by
+//AddMultisig
+func (ws Wallets) GetRedeemScript(address string) ([]byte, error) {
+	script, ok := ws.Multisigs[address]
+	if !ok {
+		return nil, ErrWalletNotFound
+	}
+
+	return script, nil
+}
+
+//GetMultisigAddresses returns the multisig addresses kept by AddMultisig
+func (ws *Wallets) GetMultisigAddresses() []string {
+	var addresses []string
+
+	for address := range ws.Multisigs {
+		addresses = append(addresses, address)
+	}
+
+	return addresses
 }
 
-func (ws *Wallets) SaveFile(nodeId string) {
+func (ws *Wallets) SaveFile(nodeId string) error {
 	var (
 		content bytes.Buffer
 	)
 
 	walletFile := fmt.Sprintf(walletFilePath, nodeId)
-	gob.Register(elliptic.P256())
 
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(ws)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
-	if err != nil {
-		log.Panic(err)
-	}
+	return ioutil.WriteFile(walletFile, content.Bytes(), 0644)
 }
 
+//LoadFile reads the wallets of nodeId. When there is no wallet file yet the
+//error from os.Stat is returned, check it with os.IsNotExist
 func (ws *Wallets) LoadFile(nodeId string) error {
 	var (
 		wallets Wallets
@@ -84,17 +140,44 @@ func (ws *Wallets) LoadFile(nodeId string) error {
 
 	fileContent, err := ioutil.ReadFile(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
-		log.Panic(err)
+		if wallets, err = decodeLegacyWallets(fileContent); err != nil {
+			return err
+		}
 	}
 
 	ws.Wallets = wallets.Wallets
+	//wallet files written before multisig addresses have none
+	if wallets.Multisigs != nil {
+		ws.Multisigs = wallets.Multisigs
+	}
 
 	return nil
 }
+
+//decodeLegacyWallets reads a wallet file written before Wallet had GobEncode.
+//SaveFile then writes it in the current format
+func decodeLegacyWallets(data []byte) (Wallets, error) {
+	var legacy legacyWallets
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&legacy); err != nil {
+		return Wallets{}, err
+	}
+
+	wallets := Wallets{Wallets: make(map[string]*Wallet)}
+	for address, w := range legacy.Wallets {
+		if w.PrivateKey.D == nil {
+			return Wallets{}, fmt.Errorf("wallet %s has no private key", address)
+		}
+		wallet := restoreWallet(w.PrivateKey.D, w.Publickey)
+		wallets.Wallets[address] = &wallet
+	}
+
+	return wallets, nil
+}
@@ -0,0 +1,71 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//testdata/wallets_legacy.data was written before Wallet had GobEncode, the
+//second of its wallets has a public key with a short coordinate
+func TestLoadLegacyWallets(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/wallets_legacy.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("tmp", "wallets_legacy.data"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{
+		"13Tj4vPa7ZkXcENaWXVeWx4KhfTk9dJeZt": PublicKeyLength,
+		"1LM9qTCM8TXPCJGQoJ3eojhxo1ZU54qmSj": PublicKeyLength - 1,
+	}
+	for round := 0; round < 2; round++ {
+		wallets, err := CreateWallet("legacy")
+		if err != nil {
+			t.Fatalf("round %d: %s", round, err)
+		}
+		if len(wallets.Wallets) != len(want) {
+			t.Fatalf("round %d: %d wallets, want %d", round, len(wallets.Wallets), len(want))
+		}
+
+		for address, keyLength := range want {
+			w, err := wallets.GetWalletFromAddress(address)
+			if err != nil {
+				t.Fatalf("round %d: %s", round, err)
+			}
+			if string(w.Address()) != address || len(w.Publickey) != keyLength {
+				t.Fatalf("round %d: wallet %s has address %s", round, address, w.Address())
+			}
+
+			hash := sha256.Sum256([]byte(address))
+			signature, err := Sign(&w.PrivateKey, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !Verify(w.Publickey, hash[:], signature) {
+				t.Fatalf("round %d: signature of %s does not verify", round, address)
+			}
+		}
+
+		//the second round reads the file in the current format
+		if err := wallets.SaveFile("legacy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}